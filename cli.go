@@ -0,0 +1,67 @@
+package daemons
+
+import (
+	"github.com/phantom-d/go-daemons/config"
+
+	flag "github.com/spf13/pflag"
+
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Main runs the command line of the application and returns its exit code.
+// It is called after config.Init, registration of daemons and workers and
+// flag.Parse:
+//
+//	func main() {
+//		config.Init()
+//		imports.Factory.Register("users", func() imports.WorkerInterface { return &Users{} })
+//		flag.Parse()
+//		os.Exit(daemons.Main())
+//	}
+//
+// The configuration files given by --config are loaded first. With
+// --check-config the configuration is validated, with --signal the control
+// command is sent to the running watcher, or run by the process like logs
+// and enqueue, its target and arguments follow the flags:
+//
+//	app -c app.yaml -s stop import
+//	app -c app.yaml -s logs users -f
+//
+// Otherwise the daemon given by --daemon is started, or its worker given by
+// --worker.
+func Main() int {
+	// Unknown keys are problems of the checked configuration.
+	config.StrictKeys = config.StrictKeys || config.Cfg().CheckConfig
+	if err := config.Configure(); err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		return config.ExitFailure
+	}
+	cfg := config.Cfg()
+	switch {
+	case cfg.CheckConfig:
+		return config.ExitCode(CheckConfig(os.Stdout))
+	case cfg.Signal != ``:
+		if err := Command(os.Stdout, cfg.Signal, flag.Args()...); err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			return config.ExitFailure
+		}
+		return config.ExitSuccess
+	}
+	d := New(cfg.Daemon)
+	if d == nil {
+		return config.ExitFailure
+	}
+	var err error
+	if cfg.Worker != `` {
+		err = d.Run()
+	} else {
+		err = Start(d)
+	}
+	var exitErr *config.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		config.Log().Error().Err(err).Msgf("Daemon '%s'", cfg.Daemon)
+	}
+	return config.ExitCode(err)
+}
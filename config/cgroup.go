@@ -0,0 +1,294 @@
+package config
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// CgroupEnv is the environment variable passing the cgroup subtree of the
+// daemons to child processes.
+const CgroupEnv = "GO_DAEMONS_CGROUP"
+
+// cgroupControllers are enabled in the cgroup subtree of the daemons.
+var cgroupControllers = []string{"cpu", "memory", "pids", "io"}
+
+// ErrNoCgroup is returned when cgroup v2 is not available.
+var ErrNoCgroup = errors.New("cgroup v2 is not available")
+
+// Resources are cgroup v2 limits of a daemon-process. Zero values mean no
+// limit.
+type Resources struct {
+	// CPU is the number of CPUs the process may use, e.g. 0.5, set as cpu.max.
+	CPU float64 `yaml:"cpu" mapstructure:"CPU"`
+	// MemoryMax is memory.max in bytes.
+	MemoryMax uint64 `yaml:"memory-max" mapstructure:"MemoryMax"`
+	// PidsMax is pids.max, the number of processes and threads.
+	PidsMax int `yaml:"pids-max" mapstructure:"PidsMax"`
+	// IOWeight is io.weight in range [1, 10000], the default weight is 100.
+	IOWeight int `yaml:"io-weight" mapstructure:"IOWeight"`
+}
+
+// Empty reports whether no limits are set.
+func (r Resources) Empty() bool {
+	return r == Resources{}
+}
+
+// UsesCgroups reports whether an enabled daemon or worker sets Resources or
+// MemoryCgroup. Otherwise cgroups are left as they are: no subtree is created
+// and processes stay in the cgroup of the supervisor.
+func (cfg *Config) UsesCgroups() bool {
+	for _, daemon := range cfg.Daemons {
+		if !daemon.Enabled {
+			continue
+		}
+		if daemon.MemoryCgroup || !daemon.Resources.Empty() {
+			return true
+		}
+		for _, worker := range daemon.Workers {
+			if worker.Enabled && (worker.MemoryCgroup || !worker.Resources.Empty()) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (r Resources) validate(path string, errs *ValidationError) {
+	if r.CPU < 0 {
+		errs.Add(path+".CPU", "must not be negative")
+	}
+	if r.PidsMax < 0 {
+		errs.Add(path+".PidsMax", "must not be negative")
+	}
+	if r.IOWeight < 0 || r.IOWeight > 10000 {
+		errs.Add(path+".IOWeight", "must be in range [1, 10000]")
+	}
+}
+
+// A Cgroup is a cgroup v2 directory created for a daemon-process.
+type Cgroup struct {
+	Path string
+}
+
+var (
+	cgroupOnce    sync.Once
+	cgroupSubtree string
+	cgroupErr     error
+)
+
+// CgroupSubtree returns the cgroup directory holding cgroups of the daemons.
+// The first daemon creating it makes "go-daemons" under its own cgroup with
+// the controllers enabled, moves itself into the "supervisor" leaf of it and
+// passes the subtree to its children in CgroupEnv, so all daemons and workers
+// get sibling cgroups.
+func CgroupSubtree() (string, error) {
+	cgroupOnce.Do(func() {
+		if cgroupSubtree = os.Getenv(CgroupEnv); cgroupSubtree != "" {
+			return
+		}
+		if cgroupSubtree, cgroupErr = createCgroupSubtree(); cgroupErr != nil {
+			cgroupSubtree = ""
+			return
+		}
+		cgroupErr = os.Setenv(CgroupEnv, cgroupSubtree)
+	})
+	return cgroupSubtree, cgroupErr
+}
+
+func createCgroupSubtree() (subtree string, err error) {
+	var parent string
+	if parent, err = cgroupParent(); err != nil {
+		return
+	}
+	var controllers []string
+	if controllers, err = enabledControllers(parent); err != nil {
+		return
+	}
+	var enabled []string
+	if enabled, err = subtreeControllers(parent); err != nil {
+		return
+	}
+	subtree = filepath.Join(parent, "go-daemons")
+	supervisor := &Cgroup{Path: filepath.Join(subtree, "supervisor")}
+	if err = os.MkdirAll(supervisor.Path, 0755); err != nil {
+		return
+	}
+	// A cgroup with enabled controllers must not have processes, so the
+	// current process leaves the parent cgroup.
+	if err = supervisor.Add(os.Getpid()); err != nil {
+		_ = supervisor.Remove()
+		_ = os.Remove(subtree)
+		return
+	}
+	if err = writeControllers(parent, controllers); err == nil {
+		err = writeControllers(subtree, controllers)
+	}
+	if err != nil {
+		// The parent cgroup is left as it was: other processes of it, if
+		// any, do not allow the controllers.
+		_ = disableControllers(parent, controllers, enabled)
+		_ = (&Cgroup{Path: parent}).Add(os.Getpid())
+		_ = supervisor.Remove()
+		_ = os.Remove(subtree)
+	}
+	return
+}
+
+// enabledControllers returns controllers of cgroupControllers available in
+// the cgroup.
+func enabledControllers(path string) (controllers []string, err error) {
+	var data []byte
+	if data, err = os.ReadFile(filepath.Join(path, "cgroup.controllers")); err != nil {
+		return
+	}
+	available := strings.Fields(string(data))
+	for _, controller := range cgroupControllers {
+		for _, name := range available {
+			if name == controller {
+				controllers = append(controllers, controller)
+			}
+		}
+	}
+	if len(controllers) == 0 {
+		err = fmt.Errorf("no controllers available in '%s'", path)
+	}
+	return
+}
+
+// subtreeControllers returns controllers enabled for children of the cgroup.
+func subtreeControllers(path string) (controllers []string, err error) {
+	var data []byte
+	if data, err = os.ReadFile(filepath.Join(path, "cgroup.subtree_control")); err == nil {
+		controllers = strings.Fields(string(data))
+	}
+	return
+}
+
+// disableControllers disables controllers of the cgroup except the enabled
+// ones.
+func disableControllers(path string, controllers, enabled []string) error {
+	var disabled []string
+	for _, controller := range controllers {
+		found := false
+		for _, name := range enabled {
+			found = found || name == controller
+		}
+		if !found {
+			disabled = append(disabled, "-"+controller)
+		}
+	}
+	if len(disabled) == 0 {
+		return nil
+	}
+	return os.WriteFile(filepath.Join(path, "cgroup.subtree_control"), []byte(strings.Join(disabled, " ")), 0)
+}
+
+func writeControllers(path string, controllers []string) error {
+	value := "+" + strings.Join(controllers, " +")
+	if err := os.WriteFile(filepath.Join(path, "cgroup.subtree_control"), []byte(value), 0); err != nil {
+		return fmt.Errorf("enable controllers in '%s': %w", path, err)
+	}
+	return nil
+}
+
+// cgroupParent returns the cgroup v2 directory of the current process.
+func cgroupParent() (path string, err error) {
+	var mount string
+	if mount, err = cgroupMount(); err != nil {
+		return
+	}
+	var data []byte
+	if data, err = os.ReadFile("/proc/self/cgroup"); err != nil {
+		return
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(line, "0::") {
+			return filepath.Join(mount, strings.TrimPrefix(line, "0::")), nil
+		}
+	}
+	return "", ErrNoCgroup
+}
+
+func cgroupMount() (mount string, err error) {
+	var file *os.File
+	if file, err = os.Open("/proc/self/mountinfo"); err != nil {
+		return
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		for i, field := range fields {
+			if field == "-" && i+1 < len(fields) && fields[i+1] == "cgroup2" {
+				return fields[4], nil
+			}
+		}
+	}
+	if err = scanner.Err(); err == nil {
+		err = ErrNoCgroup
+	}
+	return
+}
+
+// NewCgroup creates the cgroup with given name in the cgroup subtree of the
+// daemons.
+func NewCgroup(name string) (cgroup *Cgroup, err error) {
+	var subtree string
+	if subtree, err = CgroupSubtree(); err != nil {
+		return
+	}
+	cgroup = &Cgroup{Path: filepath.Join(subtree, name)}
+	if err = os.Mkdir(cgroup.Path, 0755); err != nil && !errors.Is(err, os.ErrExist) {
+		return nil, err
+	}
+	return cgroup, nil
+}
+
+// SetResources writes limits of the cgroup. Every limit is tried, the
+// returned error describes all of failed ones.
+func (c *Cgroup) SetResources(resources Resources) error {
+	var failed []string
+	set := func(file, value string) {
+		if err := c.write(file, value); err != nil {
+			failed = append(failed, err.Error())
+		}
+	}
+	if resources.CPU > 0 {
+		const period = 100000
+		set("cpu.max", fmt.Sprintf("%d %d", int(resources.CPU*period), period))
+	}
+	if resources.MemoryMax > 0 {
+		set("memory.max", strconv.FormatUint(resources.MemoryMax, 10))
+	}
+	if resources.PidsMax > 0 {
+		set("pids.max", strconv.Itoa(resources.PidsMax))
+	}
+	if resources.IOWeight > 0 {
+		set("io.weight", strconv.Itoa(resources.IOWeight))
+	}
+	if len(failed) > 0 {
+		return errors.New(strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// Add moves the process into the cgroup.
+func (c *Cgroup) Add(pid int) error {
+	return c.write("cgroup.procs", strconv.Itoa(pid))
+}
+
+// Remove removes the cgroup, it must have no processes.
+func (c *Cgroup) Remove() error {
+	return os.Remove(c.Path)
+}
+
+func (c *Cgroup) write(file, value string) error {
+	return os.WriteFile(filepath.Join(c.Path, file), []byte(value), 0)
+}
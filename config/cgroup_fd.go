@@ -0,0 +1,19 @@
+//go:build go1.20
+
+package config
+
+import (
+	"os"
+	"syscall"
+)
+
+// spawnInto makes the process started with attr be created in the cgroup,
+// so the processes it forks do not escape the limits. The returned file
+// must be closed after the start.
+func (c *Cgroup) spawnInto(attr *syscall.SysProcAttr) (dir *os.File, err error) {
+	if dir, err = os.Open(c.Path); err != nil {
+		return
+	}
+	attr.UseCgroupFD, attr.CgroupFD = true, int(dir.Fd())
+	return
+}
@@ -0,0 +1,15 @@
+//go:build !go1.20
+
+package config
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// spawnInto is not supported before Go 1.20, the process is moved into the
+// cgroup after the start.
+func (c *Cgroup) spawnInto(attr *syscall.SysProcAttr) (*os.File, error) {
+	return nil, errors.New("creating a process in a cgroup requires Go 1.20")
+}
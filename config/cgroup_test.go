@@ -0,0 +1,54 @@
+package config
+
+import (
+	"testing"
+)
+
+func TestUsesCgroups(t *testing.T) {
+	tests := []struct {
+		name    string
+		daemons map[string]Daemon
+		want    bool
+	}{
+		{name: "no daemons"},
+		{
+			name:    "no limits",
+			daemons: map[string]Daemon{"import": {Enabled: true, MemoryLimit: 1 << 20, Workers: []Worker{{Enabled: true}}}},
+		},
+		{
+			name:    "daemon resources",
+			daemons: map[string]Daemon{"import": {Enabled: true, Resources: Resources{PidsMax: 10}}},
+			want:    true,
+		},
+		{
+			name:    "worker memory cgroup",
+			daemons: map[string]Daemon{"import": {Enabled: true, Workers: []Worker{{Enabled: true, MemoryCgroup: true}}}},
+			want:    true,
+		},
+		{
+			name:    "disabled daemon",
+			daemons: map[string]Daemon{"import": {MemoryCgroup: true}},
+		},
+		{
+			name:    "disabled worker",
+			daemons: map[string]Daemon{"import": {Enabled: true, Workers: []Worker{{Resources: Resources{CPU: 1}}}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{Daemons: tt.daemons}
+			if got := cfg.UsesCgroups(); got != tt.want {
+				t.Errorf("UsesCgroups() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewCgroupUnused(t *testing.T) {
+	defer func(cfg Config) { *application = cfg }(*application)
+	*application = Config{}
+	d := &Context{Name: "import", PidFileName: "import.pid"}
+	if cgroup := d.newCgroup(); cgroup != nil {
+		t.Errorf("newCgroup() = %+v, want none without limits", cgroup)
+	}
+}
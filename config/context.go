@@ -6,7 +6,9 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"syscall"
+	"time"
 )
 
 // Default file permissions for log and pid files.
@@ -16,6 +18,8 @@ const FilePerm = os.FileMode(0640)
 type Context struct {
 	Name string
 	Type string
+	// Parent is the name of the daemon supervising the worker-process.
+	Parent string
 	// If PidFileName is non-empty, parent process will try to create and lock
 	// pid file with given name. Child process writes process id to file.
 	PidFileName string
@@ -39,8 +43,44 @@ type Context struct {
 	// If Umask is non-zero, the daemon-process call Umask() func with given value.
 	Umask int
 
+	// Run places the daemon-process into a dedicated leaf cgroup v2, if
+	// cgroup v2 is available and Resources are set or Config.UsesCgroups,
+	// with the limits of Resources set. The process runs without the limits
+	// if cgroup v2 or a controller is not available.
+	Resources Resources
+
+	// If Exits is non-nil, Run sends the exit status of the daemon-process
+	// to the channel as soon as the process is reaped. The send is abandoned
+	// when Stopped is closed, as the supervisor does not read Exits anymore.
+	Exits   chan<- ExitEvent `json:"-"`
+	Stopped <-chan struct{}  `json:"-"`
+
 	// Struct contains only serializable public fields (!!!)
 	pidFile *LockFile
+	cmd     *exec.Cmd
+	cgroup  *Cgroup
+	started time.Time
+	exit    *ExitEvent
+	done    chan struct{}
+}
+
+// An ExitEvent describes termination of a daemon-process started by Run.
+type ExitEvent struct {
+	Name string
+	Type string
+	Pid  int
+	// Code is the exit code of the process, -1 if it was killed by a signal.
+	Code int
+	// Signal is the name of the signal terminated the process, if any.
+	Signal  string
+	Err     error
+	Started time.Time
+	Exited  time.Time
+}
+
+// Failed reports whether the process has exited abnormally.
+func (e ExitEvent) Failed() bool {
+	return e.Code != 0 || e.Signal != "" || e.Err != nil
 }
 
 // Search searches daemons process by given in context pid file name.
@@ -72,6 +112,9 @@ func (d *Context) Release() (err error) {
 	return
 }
 
+// Run starts the daemon-process. Its stdout and stderr are read through
+// pipes and logged by the current process line by line, tagged with the
+// daemon, worker, pid and stream.
 func (d *Context) Run() (child *os.Process, err error) {
 	if err = d.prepareEnv(); err != nil {
 		return
@@ -79,31 +122,181 @@ func (d *Context) Run() (child *os.Process, err error) {
 
 	defer d.closeFiles()
 
-	cmd := &exec.Cmd{
+	var outputs []*output
+	if outputs, err = d.openOutput(); err != nil {
+		return
+	}
+	cgroup := d.newCgroup()
+	var placed bool
+	if placed, err = d.start(outputs, cgroup); err != nil {
+		closeOutput(outputs)
+		if cgroup != nil {
+			_ = cgroup.Remove()
+		}
+		if d.pidFile != nil {
+			_ = d.pidFile.Remove()
+		}
+		return
+	}
+	child = d.cmd.Process
+	logged := logOutput(outputs, child.Pid)
+	if cgroup != nil && !placed {
+		if err := cgroup.Add(child.Pid); err != nil {
+			_ = cgroup.Remove()
+			cgroup = nil
+			d.warnResources(err)
+		}
+	}
+	d.cgroup = cgroup
+	d.started = time.Now()
+	d.done = make(chan struct{})
+	go d.wait(logged)
+	return
+}
+
+// Cmd returns the command of the daemon-process started by Run.
+func (d *Context) Cmd() *exec.Cmd {
+	return d.cmd
+}
+
+// Done returns a channel that is closed when the daemon-process started
+// by Run is reaped. Returns nil if the process was not started.
+func (d *Context) Done() <-chan struct{} {
+	return d.done
+}
+
+// Running reports whether the daemon-process started by Run is alive.
+func (d *Context) Running() bool {
+	if d.done == nil {
+		return false
+	}
+	select {
+	case <-d.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// Exit returns the exit status of the daemon-process started by Run,
+// or nil if the process is still running.
+func (d *Context) Exit() *ExitEvent {
+	if d.done == nil {
+		return nil
+	}
+	select {
+	case <-d.done:
+		return d.exit
+	default:
+		return nil
+	}
+}
+
+func (d *Context) command(outputs []*output) *exec.Cmd {
+	return &exec.Cmd{
 		Path:   d.Args[0],
 		Args:   d.Args,
 		Dir:    d.WorkDir,
 		Env:    d.Env,
 		Stdin:  os.Stdin,
-		Stdout: os.Stdout,
-		Stderr: os.Stderr,
+		Stdout: outputs[0].writer,
+		Stderr: outputs[1].writer,
 		SysProcAttr: &syscall.SysProcAttr{
 			//Chroot:     d.Chroot,
 			Credential: d.Credential,
 			Setsid:     true,
 		},
 	}
-	defer cmd.Wait()
+}
 
-	if err = cmd.Start(); err != nil {
-		if d.pidFile != nil {
-			_ = d.pidFile.Remove()
+// start starts the daemon-process, in the cgroup if it is not nil. Returns
+// whether the process is created in the cgroup, otherwise it must be moved.
+func (d *Context) start(outputs []*output, cgroup *Cgroup) (placed bool, err error) {
+	d.cmd = d.command(outputs)
+	if cgroup != nil {
+		var dir *os.File
+		if dir, err = cgroup.spawnInto(d.cmd.SysProcAttr); err == nil {
+			err = d.cmd.Start()
+			_ = dir.Close()
+			if err == nil {
+				return true, nil
+			}
+			// The kernel may not support creating a process in a cgroup.
+			d.cmd = d.command(outputs)
 		}
-		return
 	}
+	err = d.cmd.Start()
 	return
 }
 
+// newCgroup creates the leaf cgroup of the daemon-process with the limits
+// set. Every process gets its own one, so no cgroup of the subtree has both
+// processes and children. Returns nil if cgroup v2 is not available or
+// neither the process nor the configuration uses cgroups.
+func (d *Context) newCgroup() *Cgroup {
+	if d.Resources.Empty() && !Cfg().UsesCgroups() {
+		return nil
+	}
+	name := strings.TrimSuffix(filepath.Base(d.PidFileName), filepath.Ext(d.PidFileName))
+	cgroup, err := NewCgroup(name)
+	if err != nil {
+		d.warnResources(err)
+		return nil
+	}
+	if !d.Resources.Empty() {
+		if err = cgroup.SetResources(d.Resources); err != nil {
+			Log().Warn().Err(err).Msgf("Resource limits of %s '%s' are not set", d.Type, d.Name)
+		}
+	}
+	return cgroup
+}
+
+// warnResources logs the cgroup failure if the process has limits.
+func (d *Context) warnResources(err error) {
+	if d.Resources.Empty() {
+		Log().Debug().Err(err).Msgf("Cgroup of %s '%s' is not created", d.Type, d.Name)
+		return
+	}
+	Log().Warn().Err(err).Msgf("Resource limits of %s '%s' are not enforced by cgroup", d.Type, d.Name)
+}
+
+// wait reaps the daemon-process, its exit is reported after the output is
+// logged, so a panic trace precedes the exit event.
+func (d *Context) wait(logged <-chan struct{}) {
+	err := d.cmd.Wait()
+	waitOutput(logged)
+	if d.cgroup != nil {
+		if err := d.cgroup.Remove(); err != nil {
+			Log().Warn().Err(err).Msgf("Remove cgroup of %s '%s'", d.Type, d.Name)
+		}
+	}
+	event := ExitEvent{
+		Name:    d.Name,
+		Type:    d.Type,
+		Pid:     d.cmd.Process.Pid,
+		Started: d.started,
+		Exited:  time.Now(),
+	}
+	if state := d.cmd.ProcessState; state != nil {
+		event.Code = state.ExitCode()
+		if status, ok := state.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			event.Signal = status.Signal().String()
+		}
+	}
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		event.Err = err
+	}
+	d.exit = &event
+	close(d.done)
+	if d.Exits != nil {
+		select {
+		case d.Exits <- event:
+		case <-d.Stopped:
+		}
+	}
+}
+
 func (d *Context) CreatePidFile() (err error) {
 	if len(d.PidFileName) > 0 {
 		if d.PidFilePerm == 0 {
@@ -137,6 +330,39 @@ func (d *Context) GetStatus() (result bool, err error) {
 	return
 }
 
+// Hold creates the hold file, which prevents the daemon-process from being
+// started by its supervisor until Unhold is called.
+func (d *Context) Hold() error {
+	return os.WriteFile(d.holdFileName(), nil, FilePerm)
+}
+
+// Unhold removes the hold file created by Hold.
+func (d *Context) Unhold() (err error) {
+	if err = os.Remove(d.holdFileName()); errors.Is(err, fs.ErrNotExist) {
+		err = nil
+	}
+	return
+}
+
+// Held reports whether the daemon-process is held by Hold.
+func (d *Context) Held() bool {
+	if len(d.PidFileName) == 0 {
+		return false
+	}
+	_, err := os.Stat(d.holdFileName())
+	return err == nil
+}
+
+// FileName returns name of a file kept next to the pid file, which has
+// the given extension instead of the pid file one.
+func (d *Context) FileName(ext string) string {
+	return strings.TrimSuffix(d.PidFileName, filepath.Ext(d.PidFileName)) + ext
+}
+
+func (d *Context) holdFileName() string {
+	return d.FileName(".hold")
+}
+
 func (d *Context) closeFiles() (err error) {
 	if d.pidFile != nil {
 		_ = d.pidFile.Close()
@@ -0,0 +1,82 @@
+package config
+
+import (
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestContextRunExit(t *testing.T) {
+	shell, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip(err)
+	}
+	tests := []struct {
+		name   string
+		script string
+		code   int
+		signal string
+		failed bool
+	}{
+		{name: "success", script: "exit 0"},
+		{name: "exit code", script: "exit 3", code: 3, failed: true},
+		{name: "signal", script: "kill -KILL $$", code: -1, signal: "killed", failed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exits := make(chan ExitEvent, 1)
+			d := &Context{Name: "test", Type: "worker", Args: []string{shell, "-c", tt.script}, Exits: exits}
+			child, err := d.Run()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var event ExitEvent
+			select {
+			case event = <-exits:
+			case <-time.After(5 * time.Second):
+				t.Fatal("exit of the child is not reported")
+			}
+			if event.Pid != child.Pid || event.Name != "test" || event.Type != "worker" {
+				t.Errorf("exit event = %+v, want of worker 'test' with pid %d", event, child.Pid)
+			}
+			if event.Code != tt.code || event.Signal != tt.signal || event.Failed() != tt.failed {
+				t.Errorf("exit event code %d, signal %q, failed %v, want %d, %q, %v",
+					event.Code, event.Signal, event.Failed(), tt.code, tt.signal, tt.failed)
+			}
+			if d.Running() {
+				t.Error("Running() = true after the exit")
+			}
+			if exit := d.Exit(); exit == nil || *exit != event {
+				t.Errorf("Exit() = %+v, want %+v", exit, event)
+			}
+		})
+	}
+}
+
+func TestContextRunning(t *testing.T) {
+	shell, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip(err)
+	}
+	d := &Context{Name: "test", Type: "daemon"}
+	if d.Running() || d.Exit() != nil || d.Done() != nil {
+		t.Fatal("Context is running before Run")
+	}
+	d.Args = []string{shell, "-c", "sleep 10"}
+	child, err := d.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !d.Running() || d.Exit() != nil {
+		t.Error("Running() = false before the exit")
+	}
+	_ = child.Kill()
+	select {
+	case <-d.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Done() is not closed after the exit")
+	}
+	if exit := d.Exit(); exit == nil || exit.Signal != "killed" {
+		t.Errorf("Exit() = %+v, want killed", exit)
+	}
+}
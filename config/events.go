@@ -0,0 +1,98 @@
+package config
+
+import (
+	"net"
+	"net/url"
+	"sort"
+	"time"
+)
+
+// Lifecycle events of daemons and workers emitted by their supervisors.
+const (
+	EventSpawned        = "spawned"
+	EventExited         = "exited"
+	EventRestarting     = "restarting"
+	EventBackoffGiveUp  = "backoff-give-up"
+	EventMemoryExceeded = "memory-exceeded"
+	EventConfigReloaded = "config-reloaded"
+	// EventAll configures a hook run on every event.
+	EventAll = "*"
+)
+
+// DefaultEventTimeout limits a hook run if its Timeout is not set.
+const DefaultEventTimeout = 10 * time.Second
+
+// An EventHook is run on a lifecycle event: the shell command gets the event
+// as JSON on stdin and in the GO_DAEMONS_EVENT* environment variables, the
+// event is posted as JSON to the URL, which must be local.
+type EventHook struct {
+	Command string        `yaml:"command" mapstructure:"Command"`
+	URL     string        `yaml:"url" mapstructure:"URL"`
+	Timeout time.Duration `yaml:"timeout" mapstructure:"Timeout"`
+}
+
+// Deadline returns the hook timeout with the default applied.
+func (h EventHook) Deadline() time.Duration {
+	if h.Timeout <= 0 {
+		return DefaultEventTimeout
+	}
+	return h.Timeout
+}
+
+// EventHooks returns hooks configured for the event, the hook of EventAll
+// goes last.
+func (cfg *Config) EventHooks(event string) (hooks []EventHook) {
+	for _, name := range []string{event, EventAll} {
+		for key, hook := range cfg.Events {
+			if matchName(key, name) {
+				hooks = append(hooks, hook)
+			}
+		}
+	}
+	return
+}
+
+func (cfg *Config) validateEvents(errs *ValidationError) {
+	var keys []string
+	for key := range cfg.Events {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		path := "Events." + key
+		known := false
+		for _, name := range []string{EventSpawned, EventExited, EventRestarting, EventBackoffGiveUp, EventMemoryExceeded, EventConfigReloaded, EventAll} {
+			known = known || matchName(key, name)
+		}
+		if !known {
+			errs.Add(path, "unknown event, must be one of %q, %q, %q, %q, %q, %q or %q",
+				EventSpawned, EventExited, EventRestarting, EventBackoffGiveUp, EventMemoryExceeded, EventConfigReloaded, EventAll)
+		}
+		cfg.Events[key].validate(path, errs)
+	}
+}
+
+func (h EventHook) validate(path string, errs *ValidationError) {
+	if h.Command == "" && h.URL == "" {
+		errs.Add(path, "Command or URL must be set")
+	}
+	if h.Timeout < 0 {
+		errs.Add(path+".Timeout", "must not be negative")
+	}
+	if h.URL == "" {
+		return
+	}
+	u, err := url.Parse(h.URL)
+	if err != nil {
+		errs.Add(path+".URL", "%s", err)
+		return
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		errs.Add(path+".URL", "scheme must be http or https")
+	}
+	if host := u.Hostname(); host != "localhost" {
+		if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+			errs.Add(path+".URL", "host must be local, got %q", host)
+		}
+	}
+}
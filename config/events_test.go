@@ -0,0 +1,34 @@
+package config
+
+import (
+	"testing"
+)
+
+func TestEventHooks(t *testing.T) {
+	cfg := &Config{Events: map[string]EventHook{
+		"backoff_give_up": {Command: "notify"},
+		EventAll:          {URL: "http://localhost/events"},
+	}}
+	tests := []struct {
+		event string
+		want  []EventHook
+	}{
+		{event: EventBackoffGiveUp, want: []EventHook{{Command: "notify"}, {URL: "http://localhost/events"}}},
+		{event: EventSpawned, want: []EventHook{{URL: "http://localhost/events"}}},
+	}
+	for _, tt := range tests {
+		hooks := cfg.EventHooks(tt.event)
+		if len(hooks) != len(tt.want) {
+			t.Errorf("EventHooks(%q) = %+v, want %+v", tt.event, hooks, tt.want)
+			continue
+		}
+		for i := range hooks {
+			if hooks[i] != tt.want[i] {
+				t.Errorf("EventHooks(%q) = %+v, want %+v", tt.event, hooks, tt.want)
+			}
+		}
+	}
+	if d := (EventHook{}).Deadline(); d != DefaultEventTimeout {
+		t.Errorf("Deadline() = %s, want %s", d, DefaultEventTimeout)
+	}
+}
@@ -0,0 +1,72 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// Exit codes of daemons and workers run once.
+const (
+	// ExitSuccess reports that all entities were processed.
+	ExitSuccess = 0
+	// ExitFailure reports a fatal error: a hook failed, the run was skipped
+	// or interrupted.
+	ExitFailure = 1
+	// ExitPartial reports that some entities were returned as error items.
+	ExitPartial = 2
+)
+
+// An ExitError reports a non-zero exit code of a run.
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit code %d", e.Code)
+}
+
+// ExitCode returns the exit code of the process finished with given error:
+// ExitSuccess for nil, the code of ExitError or ExitFailure otherwise.
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitSuccess
+	}
+	var exitErr *ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.Code
+	}
+	return ExitFailure
+}
+
+// WorseExit returns the more severe of two exit codes. A failure is worse
+// than a partial failure, any other non-zero code is a failure.
+func WorseExit(a, b int) int {
+	if a != ExitSuccess && a != ExitPartial || b != ExitSuccess && b != ExitPartial {
+		return ExitFailure
+	}
+	if a == ExitPartial || b == ExitPartial {
+		return ExitPartial
+	}
+	return ExitSuccess
+}
+
+// NewExitError returns nil for ExitSuccess or ExitError with the code.
+func NewExitError(code int) error {
+	if code == ExitSuccess {
+		return nil
+	}
+	return &ExitError{Code: code}
+}
+
+// StopSignal returns the signal the process is stopped by, received from
+// stopped, or SIGTERM if it is stopped without a signal.
+func StopSignal(stopped <-chan os.Signal) os.Signal {
+	select {
+	case s := <-stopped:
+		return s
+	default:
+		return syscall.SIGTERM
+	}
+}
@@ -0,0 +1,60 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestStopSignal(t *testing.T) {
+	stopped := make(chan os.Signal, 1)
+	if s := StopSignal(stopped); s != syscall.SIGTERM {
+		t.Errorf("StopSignal() without a signal = %v, want SIGTERM", s)
+	}
+	stopped <- syscall.SIGQUIT
+	if s := StopSignal(stopped); s != syscall.SIGQUIT {
+		t.Errorf("StopSignal() = %v, want SIGQUIT", s)
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{name: "success", want: ExitSuccess},
+		{name: "exit error", err: NewExitError(ExitPartial), want: ExitPartial},
+		{name: "wrapped exit error", err: fmt.Errorf("worker: %w", &ExitError{Code: 3}), want: 3},
+		{name: "other error", err: errors.New("boom"), want: ExitFailure},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ExitCode(tt.err); got != tt.want {
+				t.Errorf("ExitCode(%v) = %d, want %d", tt.err, got, tt.want)
+			}
+		})
+	}
+	if err := NewExitError(ExitSuccess); err != nil {
+		t.Errorf("NewExitError(ExitSuccess) = %v, want nil", err)
+	}
+}
+
+func TestWorseExit(t *testing.T) {
+	tests := []struct {
+		a, b, want int
+	}{
+		{a: ExitSuccess, b: ExitSuccess, want: ExitSuccess},
+		{a: ExitSuccess, b: ExitPartial, want: ExitPartial},
+		{a: ExitPartial, b: ExitFailure, want: ExitFailure},
+		{a: 3, b: ExitSuccess, want: ExitFailure},
+		{a: ExitPartial, b: 143, want: ExitFailure},
+	}
+	for _, tt := range tests {
+		if got := WorseExit(tt.a, tt.b); got != tt.want {
+			t.Errorf("WorseExit(%d, %d) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
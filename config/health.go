@@ -0,0 +1,140 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultHealthTimeout is the least time the loop may not tick before the
+// process is reported as not alive.
+const DefaultHealthTimeout = time.Minute
+
+// A HealthCheck describes the health endpoints of a daemon or a worker.
+type HealthCheck struct {
+	// Listen is the address serving "/healthz" and "/readyz". Empty value
+	// disables the endpoints.
+	Listen string `yaml:"listen" mapstructure:"Listen"`
+	// Timeout is the time the processing loop may not tick before the process
+	// is reported as not alive. Defaults to three sleep periods, but not less
+	// than DefaultHealthTimeout.
+	Timeout time.Duration `yaml:"timeout" mapstructure:"Timeout"`
+}
+
+// A Health tracks liveness and readiness of a processing loop. The loop
+// calls Tick on every iteration and SetReady after checking its dependencies.
+type Health struct {
+	name     string
+	timeout  time.Duration
+	mu       sync.Mutex
+	tick     time.Time
+	ready    error
+	stopping bool
+}
+
+// NewHealth returns a health of the loop ticking every sleep period. The
+// loop is not ready until SetReady is called.
+func NewHealth(name string, check HealthCheck, sleep time.Duration) *Health {
+	timeout := check.Timeout
+	if timeout <= 0 {
+		timeout = 3 * sleep
+		if timeout < DefaultHealthTimeout {
+			timeout = DefaultHealthTimeout
+		}
+	}
+	return &Health{
+		name:    name,
+		timeout: timeout,
+		tick:    time.Now(),
+		ready:   errors.New("not started"),
+	}
+}
+
+// Tick records an iteration of the loop.
+func (h *Health) Tick() {
+	h.mu.Lock()
+	h.tick = time.Now()
+	h.mu.Unlock()
+}
+
+// Interval returns the period the loop should tick at while it waits for the
+// next run, so the process is not reported as not alive between the runs.
+func (h *Health) Interval() time.Duration {
+	return h.timeout / 3
+}
+
+// SetReady records result of the readiness check, nil means ready.
+func (h *Health) SetReady(err error) {
+	h.mu.Lock()
+	h.ready = err
+	h.mu.Unlock()
+}
+
+// Stopping marks the process as not ready because it is shutting down.
+func (h *Health) Stopping() {
+	h.mu.Lock()
+	h.stopping = true
+	h.mu.Unlock()
+}
+
+// Live returns an error if the loop has not ticked within the timeout.
+func (h *Health) Live() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if since := time.Since(h.tick); since > h.timeout {
+		return fmt.Errorf("no tick for %s", since.Round(time.Second))
+	}
+	return nil
+}
+
+// Ready returns an error if the process is not alive, is stopping or has
+// failed the readiness check.
+func (h *Health) Ready() error {
+	if err := h.Live(); err != nil {
+		return err
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.stopping {
+		return errors.New("stopping")
+	}
+	return h.ready
+}
+
+// Serve serves "/healthz" and "/readyz" on the address until the returned
+// close function is called.
+func (h *Health) Serve(address string) (closeHealth func(), err error) {
+	var listener net.Listener
+	if listener, err = net.Listen("tcp", address); err != nil {
+		return
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", probe(h.Live))
+	mux.HandleFunc("/readyz", probe(h.Ready))
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	Log().Info().Msgf("Serve health checks of '%s' on '%s'", h.name, listener.Addr())
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			Log().Error().Err(err).Msgf("Health endpoint of '%s'", h.name)
+		}
+	}()
+	closeHealth = func() {
+		_ = server.Close()
+	}
+	return
+}
+
+func probe(check func() error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if err := check(); err != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = fmt.Fprintln(w, err)
+			return
+		}
+		_, _ = fmt.Fprintln(w, "ok")
+	}
+}
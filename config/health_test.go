@@ -0,0 +1,108 @@
+package config
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewHealthTimeout(t *testing.T) {
+	tests := []struct {
+		name  string
+		check HealthCheck
+		sleep time.Duration
+		want  time.Duration
+	}{
+		{name: "configured", check: HealthCheck{Timeout: time.Second}, sleep: time.Hour, want: time.Second},
+		{name: "default", sleep: time.Second, want: DefaultHealthTimeout},
+		{name: "three sleep periods", sleep: time.Hour, want: 3 * time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewHealth("test", tt.check, tt.sleep).timeout; got != tt.want {
+				t.Errorf("timeout = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHealthProbes(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(h *Health)
+		live   string
+		ready  string
+	}{
+		{name: "not started", ready: "not started"},
+		{name: "ready", change: func(h *Health) { h.SetReady(nil) }},
+		{name: "not ready", change: func(h *Health) { h.SetReady(errors.New("no database")) }, ready: "no database"},
+		{
+			name: "stopping",
+			change: func(h *Health) {
+				h.SetReady(nil)
+				h.Stopping()
+			},
+			ready: "stopping",
+		},
+		{
+			name: "no tick",
+			change: func(h *Health) {
+				h.SetReady(nil)
+				h.tick = time.Now().Add(-2 * time.Minute)
+			},
+			live:  "no tick for 2m0s",
+			ready: "no tick for 2m0s",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHealth("test", HealthCheck{Timeout: time.Minute}, time.Second)
+			if tt.change != nil {
+				tt.change(h)
+			}
+			checks := map[string]func() error{"/healthz": h.Live, "/readyz": h.Ready}
+			for path, want := range map[string]string{"/healthz": tt.live, "/readyz": tt.ready} {
+				recorder := httptest.NewRecorder()
+				probe(checks[path])(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+				code, body := recorder.Code, strings.TrimSpace(recorder.Body.String())
+				if want == `` && (code != http.StatusOK || body != "ok") {
+					t.Errorf("%s = %d %q, want ok", path, code, body)
+				}
+				if want != `` && (code != http.StatusServiceUnavailable || body != want) {
+					t.Errorf("%s = %d %q, want %d %q", path, code, body, http.StatusServiceUnavailable, want)
+				}
+			}
+		})
+	}
+}
+
+func TestHealthServe(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	_ = listener.Close()
+	h := NewHealth("test", HealthCheck{}, time.Second)
+	closeHealth, err := h.Serve(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeHealth()
+	for path, want := range map[string]int{"/healthz": http.StatusOK, "/readyz": http.StatusServiceUnavailable} {
+		response, err := http.Get("http://" + address + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = io.Copy(io.Discard, response.Body)
+		_ = response.Body.Close()
+		if response.StatusCode != want {
+			t.Errorf("GET %s = %d, want %d", path, response.StatusCode, want)
+		}
+	}
+}
@@ -8,40 +8,90 @@ import (
 )
 
 type Config struct {
-	PidDir  string
-	LogFile string
-	Daemon  string
-	Worker  string
-	Debug   bool
-	Daemons map[string]Daemon
-	Signal  string
+	PidDir      string
+	LogFile     string
+	LogRotate   LogRotation
+	Daemon      string
+	Worker      string
+	Replica     int `mapstructure:"-"`
+	Debug       bool
+	Daemons     map[string]Daemon
+	Signal      string
+	Socket      string
+	Metrics     string
+	Events      map[string]EventHook
+	Format      string   `mapstructure:"-"`
+	ConfigFiles []string `mapstructure:"-"`
+	CheckConfig bool     `mapstructure:"-"`
+	Follow      bool     `mapstructure:"-"`
+	Lines       int      `mapstructure:"-"`
+	Once        bool     `mapstructure:"-"`
 }
 
 type Daemon struct {
-	Name        string                 `yaml:"name" mapstructure:"Name"`
-	Enabled     bool                   `yaml:"enabled" mapstructure:"Enabled"`
-	MemoryLimit uint64                 `yaml:"memory-limit" mapstructure:"MemoryLimit"`
-	Sleep       time.Duration          `yaml:"sleep" mapstructure:"Sleep"`
-	Workers     []Worker               `yaml:"workers" mapstructure:"Workers"`
-	Params      map[string]interface{} `yaml:"params" mapstructure:"Params"`
+	Name            string                 `yaml:"name" mapstructure:"Name"`
+	Enabled         bool                   `yaml:"enabled" mapstructure:"Enabled"`
+	MemoryLimit     uint64                 `yaml:"memory-limit" mapstructure:"MemoryLimit"`
+	MemoryAction    string                 `yaml:"memory-action" mapstructure:"MemoryAction"`
+	MemoryCgroup    bool                   `yaml:"memory-cgroup" mapstructure:"MemoryCgroup"`
+	Resources       Resources              `yaml:"resources" mapstructure:"Resources"`
+	Sleep           time.Duration          `yaml:"sleep" mapstructure:"Sleep"`
+	Workers         []Worker               `yaml:"workers" mapstructure:"Workers"`
+	Params          map[string]interface{} `yaml:"params" mapstructure:"Params"`
+	Restart         RestartPolicy          `yaml:"restart" mapstructure:"Restart"`
+	ShutdownTimeout time.Duration          `yaml:"shutdown-timeout" mapstructure:"ShutdownTimeout"`
+	Health          HealthCheck            `yaml:"health" mapstructure:"Health"`
+	Schedule        string                 `yaml:"schedule" mapstructure:"Schedule"`
+	Timezone        string                 `yaml:"timezone" mapstructure:"Timezone"`
 }
 
 type Worker struct {
-	Name        string        `yaml:"name" mapstructure:"Name"`
-	MemoryLimit uint64        `yaml:"memory-limit" mapstructure:"MemoryLimit"`
-	Queue       string        `yaml:"queue" mapstructure:"Queue"`
-	Enabled     bool          `yaml:"enabled" mapstructure:"Enabled"`
-	Sleep       time.Duration `yaml:"sleep" mapstructure:"Sleep"`
+	Name            string        `yaml:"name" mapstructure:"Name"`
+	MemoryLimit     uint64        `yaml:"memory-limit" mapstructure:"MemoryLimit"`
+	MemoryAction    string        `yaml:"memory-action" mapstructure:"MemoryAction"`
+	MemoryCgroup    bool          `yaml:"memory-cgroup" mapstructure:"MemoryCgroup"`
+	Resources       Resources     `yaml:"resources" mapstructure:"Resources"`
+	Queue           string        `yaml:"queue" mapstructure:"Queue"`
+	Enabled         bool          `yaml:"enabled" mapstructure:"Enabled"`
+	Sleep           time.Duration `yaml:"sleep" mapstructure:"Sleep"`
+	ShutdownTimeout time.Duration `yaml:"shutdown-timeout" mapstructure:"ShutdownTimeout"`
+	Health          HealthCheck   `yaml:"health" mapstructure:"Health"`
+	Concurrency     int           `yaml:"concurrency" mapstructure:"Concurrency"`
+	Replicas        int           `yaml:"replicas" mapstructure:"Replicas"`
+	Buffer          int           `yaml:"buffer" mapstructure:"Buffer"`
+	Ordered         bool          `yaml:"ordered" mapstructure:"Ordered"`
+	BatchTimeout    time.Duration `yaml:"batch-timeout" mapstructure:"BatchTimeout"`
+	Schedule        string        `yaml:"schedule" mapstructure:"Schedule"`
+	Timezone        string        `yaml:"timezone" mapstructure:"Timezone"`
+	Overlap         string        `yaml:"overlap" mapstructure:"Overlap"`
+	Retry           RetryPolicy   `yaml:"retry" mapstructure:"Retry"`
+	Restart         RestartPolicy `yaml:"restart" mapstructure:"Restart"`
 }
 
+// DefaultShutdownTimeout is used when ShutdownTimeout is not configured.
+const DefaultShutdownTimeout = 30 * time.Second
+
 var (
 	application *Config = &Config{}
 	logger      *zerolog.Logger
 )
 
+// Init registers the command line flags, they are handled by daemons.Main
+// after flag.Parse.
 func Init() {
 	flag.CommandLine.AddGoFlagSet(goflag.CommandLine)
 	flag.StringVarP(&application.PidDir, "pid-dir", "p", "pids", "Path to a save pid files")
-	flag.StringVarP(&application.Daemon, "daemon", "d", "watcher", "Daemon name to starting")
+	flag.StringVarP(&application.Daemon, "daemon", "d", DefaultDaemon, "Daemon name to starting")
 	flag.StringVarP(&application.Worker, "worker", "w", "", "Warker name to starting")
+	flag.IntVar(&application.Replica, "replica", 0, "Replica index of the worker to starting")
+	flag.StringSliceVarP(&application.ConfigFiles, "config", "c", nil, "Paths to configuration files or directories")
+	flag.StringVarP(&application.Signal, "signal", "s", "",
+		"Control command sent to the running watcher or run by the process, arguments follow the flags")
+	flag.StringVar(&application.Socket, "socket", "", "Path to the control socket of the watcher")
+	flag.StringVar(&application.Metrics, "metrics", "", "Listen address of the HTTP metrics endpoint, e.g. ':9100'")
+	flag.StringVar(&application.Format, "format", "table", "Output format of the status command: table or json")
+	flag.BoolVar(&application.Once, "once", false, "Run workers once and exit with a status code of the result")
+	flag.BoolVar(&application.CheckConfig, "check-config", false, "Validate configuration, unknown keys included, and exit")
+	flag.BoolVarP(&application.Follow, "follow", "f", false, "Follow the log files shown by the logs command")
+	flag.IntVarP(&application.Lines, "lines", "n", 10, "Number of the last lines shown by the logs command")
 }
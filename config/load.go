@@ -0,0 +1,234 @@
+package config
+
+import (
+	"github.com/BurntSushi/toml"
+	"github.com/mitchellh/mapstructure"
+	flag "github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// A Decoder parses content of a configuration file.
+type Decoder func(data []byte, out *map[string]interface{}) error
+
+// Decoders maps configuration file extensions to their decoders.
+var Decoders = map[string]Decoder{
+	".yaml": func(data []byte, out *map[string]interface{}) error { return yaml.Unmarshal(data, out) },
+	".yml":  func(data []byte, out *map[string]interface{}) error { return yaml.Unmarshal(data, out) },
+	".toml": func(data []byte, out *map[string]interface{}) error { return toml.Unmarshal(data, out) },
+	".json": func(data []byte, out *map[string]interface{}) error { return json.Unmarshal(data, out) },
+}
+
+// Load reads configuration from the given files and returns it with the
+// defaults applied. The format of a file is detected by its extension.
+// A directory, like conf.d, is expanded to the files with known extensions
+// in lexical order. Values of later files override values of earlier ones.
+func Load(paths ...string) (cfg *Config, err error) {
+	var files []string
+	if files, err = configFiles(paths); err != nil {
+		return
+	}
+	values := make(map[string]interface{})
+	for _, file := range files {
+		var data map[string]interface{}
+		if data, err = readFile(file); err != nil {
+			return
+		}
+		mergeValues(values, data)
+	}
+	var errs ValidationError
+	cfg = &Config{}
+	if err = decode(values, cfg, &errs); err != nil {
+		return nil, err
+	}
+	cfg.ConfigFiles = paths
+	cfg.setDefaults()
+	// Values failed to decode are missing in cfg, so checks of references
+	// between them would report misleading problems.
+	if len(errs) == 0 {
+		cfg.validate(&errs)
+	}
+	if err = errs.Err(); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// StrictKeys makes unknown configuration keys errors, by default they are
+// logged as warnings, so configurations shared with other code may have
+// extra keys. It is set by daemons.Main for --check-config.
+var StrictKeys bool
+
+// DefaultDaemon is started if the daemon is given neither by the --daemon
+// flag nor by the configuration.
+const DefaultDaemon = "watcher"
+
+// Configure loads configuration files given by the --config flag into the
+// application configuration. Command line flags take precedence over
+// values of the files, the configuration is not changed if it is invalid.
+func Configure() (err error) {
+	if len(application.ConfigFiles) == 0 {
+		return
+	}
+	var cfg *Config
+	if cfg, err = Load(application.ConfigFiles...); err != nil {
+		return
+	}
+	flags := make(map[string]string)
+	flag.Visit(func(f *flag.Flag) {
+		flags[f.Name] = f.Value.String()
+	})
+	previous := *application
+	*application = *cfg
+	// Settings given only by the command line are kept.
+	application.Replica = previous.Replica
+	application.Format = previous.Format
+	application.CheckConfig = previous.CheckConfig
+	application.Follow = previous.Follow
+	application.Lines = previous.Lines
+	application.Once = previous.Once
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name != "config" {
+			_ = f.Value.Set(flags[f.Name])
+		}
+	})
+	if application.Daemon == "" {
+		application.Daemon = DefaultDaemon
+	}
+	// The daemon given by the flag is checked against the loaded daemons.
+	if err = application.Validate(); err != nil {
+		*application = previous
+	}
+	return
+}
+
+func (cfg *Config) setDefaults() {
+	if cfg.PidDir == "" {
+		cfg.PidDir = "pids"
+	}
+	for name, daemon := range cfg.Daemons {
+		if daemon.Name == "" {
+			daemon.Name = name
+		}
+		if daemon.ShutdownTimeout <= 0 {
+			daemon.ShutdownTimeout = DefaultShutdownTimeout
+		}
+		if daemon.MemoryAction == "" {
+			daemon.MemoryAction = MemoryRestart
+		}
+		for i := range daemon.Workers {
+			if daemon.Workers[i].ShutdownTimeout <= 0 {
+				daemon.Workers[i].ShutdownTimeout = DefaultShutdownTimeout
+			}
+			if daemon.Workers[i].MemoryAction == "" {
+				daemon.Workers[i].MemoryAction = MemorySkip
+			}
+		}
+		cfg.Daemons[name] = daemon
+	}
+}
+
+func configFiles(paths []string) (files []string, err error) {
+	for _, path := range paths {
+		var info os.FileInfo
+		if info, err = os.Stat(path); err != nil {
+			return
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		var entries []os.DirEntry
+		if entries, err = os.ReadDir(path); err != nil {
+			return
+		}
+		var names []string
+		for _, entry := range entries {
+			if _, ok := Decoders[strings.ToLower(filepath.Ext(entry.Name()))]; ok && !entry.IsDir() {
+				names = append(names, filepath.Join(path, entry.Name()))
+			}
+		}
+		sort.Strings(names)
+		files = append(files, names...)
+	}
+	return
+}
+
+func readFile(name string) (values map[string]interface{}, err error) {
+	decoder, ok := Decoders[strings.ToLower(filepath.Ext(name))]
+	if !ok {
+		return nil, fmt.Errorf("config: unknown format of file '%s'", name)
+	}
+	var data []byte
+	if data, err = os.ReadFile(name); err != nil {
+		return
+	}
+	if err = decoder(data, &values); err != nil {
+		return nil, fmt.Errorf("config: file '%s': %w", name, err)
+	}
+	return
+}
+
+// mergeValues merges src into dst recursively. Keys are matched by
+// normalized name, so "pid-dir" in one file overrides "PidDir" in another.
+func mergeValues(dst, src map[string]interface{}) {
+	for key, value := range src {
+		for existing := range dst {
+			if existing != key && matchName(existing, key) {
+				dst[key] = dst[existing]
+				delete(dst, existing)
+				break
+			}
+		}
+		if srcMap, ok := value.(map[string]interface{}); ok {
+			if dstMap, ok := dst[key].(map[string]interface{}); ok {
+				mergeValues(dstMap, srcMap)
+				continue
+			}
+		}
+		dst[key] = value
+	}
+}
+
+// decode decodes values into out. Invalid values and unknown keys with
+// StrictKeys are added to errs, other errors are returned.
+func decode(values interface{}, out interface{}, errs *ValidationError) (err error) {
+	var (
+		decoder  *mapstructure.Decoder
+		metadata mapstructure.Metadata
+	)
+	decoder, err = mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook:  mapstructure.StringToTimeDurationHookFunc(),
+		ErrorUnused: StrictKeys,
+		Metadata:    &metadata,
+		MatchName:   matchName,
+		Result:      out,
+	})
+	if err != nil {
+		return
+	}
+	if err = decoder.Decode(values); err != nil {
+		errs.addDecodeErrors(err)
+		err = nil
+	}
+	sort.Strings(metadata.Unused)
+	for _, key := range metadata.Unused {
+		Log().Warn().Str("path", fieldPath(key)).Msg("Load config: unknown key")
+	}
+	return
+}
+
+// matchName compares configuration keys ignoring case, dashes and underscores.
+func matchName(key, name string) bool {
+	return strings.EqualFold(normalizeName(key), normalizeName(name))
+}
+
+func normalizeName(name string) string {
+	return strings.NewReplacer("-", "", "_", "").Replace(name)
+}
@@ -0,0 +1,120 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name   string
+		files  map[string]string
+		strict bool
+		// problems are paths of the validation problems, err is a part of
+		// other error.
+		problems []string
+		err      string
+	}{
+		{
+			name: "valid",
+			files: map[string]string{
+				"app.yaml": "daemons:\n  import: {enabled: true, sleep: 1s}\n",
+			},
+		},
+		{
+			name:  "unknown format",
+			files: map[string]string{"app.ini": "pid-dir = pids\n"},
+			err:   "unknown format",
+		},
+		{
+			name:  "syntax error",
+			files: map[string]string{"app.json": "{"},
+			err:   "app.json",
+		},
+		{
+			name: "invalid value",
+			files: map[string]string{
+				"app.toml": "[daemons.import]\nenabled = true\nsleep = \"often\"\n",
+			},
+			problems: []string{"Daemons.import.Sleep"},
+		},
+		{
+			name: "unknown key",
+			files: map[string]string{
+				"app.yaml": "daemons:\n  import: {enabled: true, sleep: 1s, slep: 2s}\n",
+			},
+		},
+		{
+			name: "strict unknown key",
+			files: map[string]string{
+				"app.yaml": "daemons:\n  import: {enabled: true, sleep: 1s, slep: 2s}\n",
+			},
+			strict:   true,
+			problems: []string{"Daemons.import.slep"},
+		},
+		{
+			name: "validation problems",
+			files: map[string]string{
+				"app.yaml": "daemon: users\ndaemons:\n  import:\n    enabled: true\n    workers: [{sleep: -1s}]\n",
+			},
+			problems: []string{"Daemon", "Daemons.import.Sleep", "Daemons.import.Workers[0].Name", "Daemons.import.Workers[0].Sleep"},
+		},
+		{
+			name: "merged files",
+			files: map[string]string{
+				"1.yaml": "daemons:\n  import: {enabled: true}\n",
+				"2.json": `{"daemons": {"import": {"sleep": "1s"}}}`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range tt.files {
+				if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			defer func(strict bool) { StrictKeys = strict }(StrictKeys)
+			StrictKeys = tt.strict
+			paths := []string{dir}
+			if len(tt.files) == 1 {
+				for name := range tt.files {
+					paths = []string{filepath.Join(dir, name)}
+				}
+			}
+			cfg, err := Load(paths...)
+			var validationErr ValidationError
+			switch {
+			case tt.problems != nil:
+				if !errors.As(err, &validationErr) {
+					t.Fatalf("Load() error = %v, want problems of %q", err, tt.problems)
+				}
+				if got := problemPaths(validationErr); !reflect.DeepEqual(got, tt.problems) {
+					t.Errorf("Load() problems = %q, want %q\n%v", got, tt.problems, err)
+				}
+			case tt.err != "":
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("Load() error = %v, want it to contain %q", err, tt.err)
+				}
+			case err != nil:
+				t.Fatalf("Load() error = %v", err)
+			default:
+				if daemon := cfg.Daemons["import"]; !daemon.Enabled || daemon.Sleep != time.Second {
+					t.Errorf("Load() daemon = %+v, want enabled with sleep 1s", daemon)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadMissingFile(t *testing.T) {
+	if _, err := Load(filepath.Join(t.TempDir(), "app.yaml")); err == nil {
+		t.Error("Load() of a missing file returns no error")
+	}
+}
@@ -0,0 +1,393 @@
+package config
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Placeholders of the LogFile path template.
+const (
+	LogDaemon = "{daemon}"
+	// LogWorker is replaced with the worker replica name, with the daemon
+	// name in the log file of a daemon.
+	LogWorker = "{worker}"
+)
+
+// LogRotation describes rotation of the log files. Rotated files get the
+// rotation time appended to their name.
+type LogRotation struct {
+	// MaxSize rotates the file before it exceeds MaxSize bytes, zero means
+	// no limit.
+	MaxSize uint64 `yaml:"max-size" mapstructure:"MaxSize"`
+	// Interval rotates the file at every Interval boundary, e.g. at
+	// midnight UTC with 24h. Zero disables time-based rotation.
+	Interval time.Duration `yaml:"interval" mapstructure:"Interval"`
+	// Compress compresses rotated files with gzip.
+	Compress bool `yaml:"compress" mapstructure:"Compress"`
+	// MaxFiles is the number of rotated files kept, zero keeps all.
+	MaxFiles int `yaml:"max-files" mapstructure:"MaxFiles"`
+	// MaxAge removes rotated files older than MaxAge, zero keeps all.
+	MaxAge time.Duration `yaml:"max-age" mapstructure:"MaxAge"`
+}
+
+func (r LogRotation) validate(path string, errs *ValidationError) {
+	if r.Interval < 0 {
+		errs.Add(path+".Interval", "must not be negative")
+	}
+	if r.MaxFiles < 0 {
+		errs.Add(path+".MaxFiles", "must not be negative")
+	}
+	if r.MaxAge < 0 {
+		errs.Add(path+".MaxAge", "must not be negative")
+	}
+}
+
+// LogPath returns the log file of the daemon, or of its worker replica if
+// worker is not empty. Returns empty string if LogFile is not set.
+func (cfg *Config) LogPath(daemon, worker string) string {
+	if cfg.LogFile == "" {
+		return ""
+	}
+	if worker == "" {
+		worker = daemon
+	}
+	return strings.NewReplacer(LogDaemon, daemon, LogWorker, worker).Replace(cfg.LogFile)
+}
+
+// orphanLogPath returns the file receiving the output of the daemon, or of
+// its worker replica, which has outlived its supervisor. It is next to the
+// pid file.
+func (cfg *Config) orphanLogPath(daemon, worker string) string {
+	name := daemon
+	if worker != "" {
+		name += "_" + worker
+	}
+	return filepath.Join(cfg.PidDir, name+".log")
+}
+
+// A LogWriter writes to the log file rotating it by size and time.
+type LogWriter struct {
+	mu       sync.Mutex
+	path     string
+	rotation LogRotation
+	file     *os.File
+	size     int64
+	opened   time.Time
+	cleanups sync.WaitGroup
+	cleanMu  sync.Mutex
+}
+
+// OpenLogWriter opens the log file for appending, its directory is created
+// if it does not exist.
+func OpenLogWriter(path string, rotation LogRotation) (w *LogWriter, err error) {
+	if path, err = filepath.Abs(path); err != nil {
+		return
+	}
+	w = &LogWriter{path: path, rotation: rotation}
+	if err = w.open(); err != nil {
+		return nil, err
+	}
+	return
+}
+
+func (w *LogWriter) open() (err error) {
+	if err = os.MkdirAll(filepath.Dir(w.path), 0750); err != nil {
+		return
+	}
+	if w.file, err = os.OpenFile(w.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, FilePerm); err != nil {
+		return
+	}
+	w.size, w.opened = 0, time.Now()
+	if info, err := w.file.Stat(); err == nil {
+		w.size = info.Size()
+		if w.size > 0 {
+			w.opened = info.ModTime()
+		}
+	}
+	return
+}
+
+func (w *LogWriter) Write(p []byte) (n int, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return 0, os.ErrClosed
+	}
+	if w.due(len(p), time.Now()) {
+		if err = w.rotate(); err != nil {
+			return
+		}
+	}
+	n, err = w.file.Write(p)
+	w.size += int64(n)
+	return
+}
+
+// due reports whether the file is rotated before writing n bytes.
+func (w *LogWriter) due(n int, now time.Time) bool {
+	if w.size == 0 {
+		return false
+	}
+	if w.rotation.MaxSize > 0 && uint64(w.size)+uint64(n) > w.rotation.MaxSize {
+		return true
+	}
+	interval := w.rotation.Interval
+	return interval > 0 && !now.Truncate(interval).Equal(w.opened.Truncate(interval))
+}
+
+// rotate renames the file and opens a new one, the rotated file is
+// compressed and old files are removed in the background.
+func (w *LogWriter) rotate() (err error) {
+	if err = w.file.Close(); err != nil {
+		return
+	}
+	w.file = nil
+	rotated := w.path + "." + time.Now().Format("20060102-150405.000")
+	for i := 1; fileExists(rotated) || fileExists(rotated+".gz"); i++ {
+		rotated = fmt.Sprintf("%s.%s-%d", w.path, time.Now().Format("20060102-150405.000"), i)
+	}
+	if err = os.Rename(w.path, rotated); err != nil {
+		return
+	}
+	if err = w.open(); err != nil {
+		return
+	}
+	w.cleanups.Add(1)
+	go w.cleanup(w.rotation)
+	return
+}
+
+func fileExists(name string) bool {
+	_, err := os.Lstat(name)
+	return err == nil
+}
+
+// cleanup compresses the rotated files and removes rotated files beyond the
+// retention limits. Cleanups run one by one.
+func (w *LogWriter) cleanup(rotation LogRotation) {
+	defer w.cleanups.Done()
+	w.cleanMu.Lock()
+	defer w.cleanMu.Unlock()
+	names, err := filepath.Glob(w.path + ".*")
+	if err != nil {
+		return
+	}
+	if rotation.Compress {
+		for _, name := range names {
+			if strings.HasSuffix(name, ".gz") || strings.HasSuffix(name, ".tmp") {
+				continue
+			}
+			if err = compressFile(name); err != nil {
+				Log().Error().Err(err).Msgf("Compress log file '%s'", name)
+			}
+		}
+		if names, err = filepath.Glob(w.path + ".*"); err != nil {
+			return
+		}
+	}
+	// Names end with the rotation time, so they are sorted from the oldest.
+	sort.Slice(names, func(i, j int) bool {
+		return strings.TrimSuffix(names[i], ".gz") < strings.TrimSuffix(names[j], ".gz")
+	})
+	for i, name := range names {
+		if strings.HasSuffix(name, ".tmp") {
+			continue
+		}
+		remove := rotation.MaxFiles > 0 && i < len(names)-rotation.MaxFiles
+		if info, err := os.Stat(name); err == nil && rotation.MaxAge > 0 {
+			remove = remove || time.Since(info.ModTime()) > rotation.MaxAge
+		}
+		if remove {
+			if err = os.Remove(name); err != nil {
+				Log().Error().Err(err).Msgf("Remove log file '%s'", name)
+			}
+		}
+	}
+}
+
+func compressFile(name string) (err error) {
+	var src, dst *os.File
+	if src, err = os.Open(name); err != nil {
+		return
+	}
+	defer src.Close()
+	if dst, err = os.OpenFile(name+".gz.tmp", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, FilePerm); err != nil {
+		return
+	}
+	zw := gzip.NewWriter(dst)
+	if _, err = io.Copy(zw, src); err == nil {
+		err = zw.Close()
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(name+".gz.tmp", name+".gz")
+	}
+	if err != nil {
+		_ = os.Remove(name + ".gz.tmp")
+		return
+	}
+	return os.Remove(name)
+}
+
+// Reopen closes and opens the log file again, so the file renamed by an
+// external tool is released.
+func (w *LogWriter) Reopen() (err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file != nil {
+		_ = w.file.Close()
+		w.file = nil
+	}
+	return w.open()
+}
+
+// Close closes the log file after the background cleanup is done.
+func (w *LogWriter) Close() (err error) {
+	w.mu.Lock()
+	if w.file != nil {
+		err = w.file.Close()
+		w.file = nil
+	}
+	w.mu.Unlock()
+	w.cleanups.Wait()
+	return
+}
+
+var (
+	logMu     sync.Mutex
+	logWriter *LogWriter
+	logReopen chan os.Signal
+	// logTarget is the output of the logger, entries logged by children are
+	// written to it.
+	logTarget io.Writer = os.Stdout
+)
+
+// OpenLog directs the log of the daemon process, or of its worker replica
+// if worker is not empty, to the file given by LogFile. The file is reopened
+// on SIGUSR1. It is called again after the configuration is reloaded, so a
+// changed LogFile or LogRotate applies; without LogFile the log is written
+// to stdout. SIGPIPE is ignored, so the process outliving its supervisor,
+// which reads its output, is not killed by writes to the closed pipe; its
+// stdout and stderr are redirected to the file next to its pid file by the
+// first log entry failed to be written, see stdoutWriter.
+func OpenLog(daemon, worker string) (err error) {
+	logMu.Lock()
+	defer logMu.Unlock()
+	path := application.LogPath(daemon, worker)
+	if path != "" {
+		if path, err = filepath.Abs(path); err != nil {
+			return
+		}
+	}
+	previous := logWriter
+	if previous != nil && previous.path == path {
+		previous.mu.Lock()
+		previous.rotation = application.LogRotate
+		previous.mu.Unlock()
+		return
+	}
+	var output io.Writer = &stdoutWriter{fallback: application.orphanLogPath(daemon, worker)}
+	logWriter = nil
+	if path != "" {
+		if logWriter, err = OpenLogWriter(path, application.LogRotate); err != nil {
+			logWriter = previous
+			return
+		}
+		output = logWriter
+	}
+	logTarget = output
+	if previous != nil {
+		_ = previous.Close()
+	}
+	if logReopen == nil {
+		log := Log().Output(logSwitch{})
+		SetLogger(&log)
+		signal.Ignore(syscall.SIGPIPE)
+		logReopen = make(chan os.Signal, 1)
+		signal.Notify(logReopen, syscall.SIGUSR1)
+		go func() {
+			for range logReopen {
+				if err := ReopenLog(); err != nil {
+					Log().Error().Err(err).Msg("Reopen log file")
+				}
+			}
+		}()
+	}
+	return
+}
+
+// A stdoutWriter writes the log to stdout. Stdout of a child process is the
+// pipe read by its supervisor, when the supervisor has exited the pipe is
+// broken and stdout and stderr of the process are redirected to the fallback
+// file, so the output of the process is kept.
+type stdoutWriter struct {
+	mu       sync.Mutex
+	fallback string
+}
+
+func (w *stdoutWriter) Write(p []byte) (n int, err error) {
+	if n, err = os.Stdout.Write(p); !errors.Is(err, syscall.EPIPE) {
+		return
+	}
+	w.mu.Lock()
+	err = redirectOutput(w.fallback)
+	w.mu.Unlock()
+	if err != nil {
+		return
+	}
+	return os.Stdout.Write(p)
+}
+
+// redirectOutput replaces stdout and stderr of the process with the file.
+func redirectOutput(path string) (err error) {
+	var file *os.File
+	if file, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, FilePerm); err != nil {
+		return
+	}
+	defer file.Close()
+	for _, fd := range []int{syscall.Stdout, syscall.Stderr} {
+		if err = syscall.Dup3(int(file.Fd()), fd, 0); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// logSwitch is the output of the logger set by OpenLog. It writes to
+// logTarget, so the output is switched without replacing the logger used by
+// running goroutines.
+type logSwitch struct{}
+
+func (logSwitch) Write(p []byte) (n int, err error) {
+	logMu.Lock()
+	target := logTarget
+	logMu.Unlock()
+	return target.Write(p)
+}
+
+// writeLog writes the log entry of a child process to the log output.
+func writeLog(entry []byte) {
+	_, _ = logSwitch{}.Write(entry)
+}
+
+// ReopenLog reopens the log file opened by OpenLog.
+func ReopenLog() error {
+	logMu.Lock()
+	defer logMu.Unlock()
+	if logWriter == nil {
+		return nil
+	}
+	return logWriter.Reopen()
+}
@@ -0,0 +1,81 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogWriterDue(t *testing.T) {
+	opened := time.Date(2024, 1, 1, 23, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		rotation LogRotation
+		size     int64
+		n        int
+		now      time.Time
+		want     bool
+	}{
+		{name: "empty file", rotation: LogRotation{MaxSize: 1}, n: 10, now: opened},
+		{name: "under size", rotation: LogRotation{MaxSize: 100}, size: 50, n: 50, now: opened},
+		{name: "over size", rotation: LogRotation{MaxSize: 100}, size: 50, n: 51, now: opened, want: true},
+		{name: "same interval", rotation: LogRotation{Interval: 24 * time.Hour}, size: 1, now: opened.Add(59 * time.Minute)},
+		{name: "next interval", rotation: LogRotation{Interval: 24 * time.Hour}, size: 1, now: opened.Add(time.Hour), want: true},
+		{name: "no limits", size: 1 << 30, n: 1, now: opened.Add(48 * time.Hour)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &LogWriter{rotation: tt.rotation, size: tt.size, opened: opened}
+			if got := w.due(tt.n, tt.now); got != tt.want {
+				t.Errorf("due() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLogWriterRotate(t *testing.T) {
+	tests := []struct {
+		name     string
+		rotation LogRotation
+		// rotated are the numbers of rotated files, compressed ones among
+		// them, after every entry is written.
+		rotated    int
+		compressed int
+	}{
+		{name: "all kept", rotation: LogRotation{MaxSize: 10}, rotated: 3},
+		{name: "max files", rotation: LogRotation{MaxSize: 10, MaxFiles: 2}, rotated: 2},
+		{name: "compressed", rotation: LogRotation{MaxSize: 10, Compress: true}, rotated: 3, compressed: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "logs", "app.log")
+			w, err := OpenLogWriter(path, tt.rotation)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < 4; i++ {
+				if _, err = w.Write([]byte("entry 01\n")); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err = w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			names, _ := filepath.Glob(path + ".*")
+			compressed := 0
+			for _, name := range names {
+				if strings.HasSuffix(name, ".gz") {
+					compressed++
+				}
+			}
+			if len(names) != tt.rotated || compressed != tt.compressed {
+				t.Errorf("rotated files = %v, want %d, %d compressed", names, tt.rotated, tt.compressed)
+			}
+			if data, err := os.ReadFile(path); err != nil || string(data) != "entry 01\n" {
+				t.Errorf("log file = %q, %v, want the last entry", data, err)
+			}
+		})
+	}
+}
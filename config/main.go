@@ -1,9 +1,9 @@
 package config
 
 import (
-	"github.com/mitchellh/mapstructure"
 	"github.com/rs/zerolog"
 	"os"
+	"path/filepath"
 )
 
 func Cfg() *Config {
@@ -17,15 +17,34 @@ func Log() *zerolog.Logger {
 	return logger
 }
 
+// SetConfig decodes cfg into the application configuration and validates
+// it. Every problem found is logged, nil is returned on invalid configuration.
 func SetConfig(cfg interface{}) *Config {
-	err := mapstructure.Decode(cfg, &application)
-	if err != nil {
-		Log().Info().Msg("Worker load config")
+	var errs ValidationError
+	if err := decode(cfg, application, &errs); err != nil {
+		Log().Error().Err(err).Msg("Load config")
+		return nil
+	}
+	if len(errs) == 0 {
+		application.validate(&errs)
+	}
+	if len(errs) > 0 {
+		for _, fieldError := range errs {
+			Log().Error().Str("path", fieldError.Path).Msgf("Load config: %s", fieldError.Message)
+		}
 		return nil
 	}
 	return application
 }
 
+// SocketPath returns path to the control socket of the watcher.
+func SocketPath() string {
+	if application.Socket != "" {
+		return application.Socket
+	}
+	return filepath.Join(application.PidDir, "watcher.sock")
+}
+
 func SetLogger(log *zerolog.Logger) *zerolog.Logger {
 	logger = log
 	return logger
@@ -0,0 +1,287 @@
+package config
+
+import (
+	"github.com/rs/zerolog"
+
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Streams of the daemon-process output.
+const (
+	StreamStdout = "stdout"
+	StreamStderr = "stderr"
+)
+
+const (
+	// outputBufferSize is the size of the buffer reading the output.
+	outputBufferSize = 64 << 10
+	// outputLineSize is the longest line logged as one event, longer lines
+	// are split.
+	outputLineSize = 1 << 20
+	// traceSize is the longest panic trace logged as one event.
+	traceSize = 1 << 20
+	// traceIdle ends the panic trace written without the process exit.
+	traceIdle = time.Second
+	// outputDrain limits the wait for the output of the exited process, its
+	// pipes may be kept open by its own children.
+	outputDrain = time.Second
+)
+
+// OnceResultKind is the kind of the JSON line printed by a worker run with
+// --once as its result. The supervisor writes such lines to resultOutput
+// instead of the log, so the results reach stdout of the first process.
+const OnceResultKind = "once-result"
+
+var (
+	resultMu     sync.Mutex
+	resultOutput io.Writer = os.Stdout
+)
+
+// tracePrefixes start the multi-line traces written by the Go runtime.
+var tracePrefixes = [][]byte{
+	[]byte("panic: "),
+	[]byte("fatal error: "),
+	[]byte("runtime: "),
+	[]byte("SIGQUIT: "),
+	[]byte("SIGABRT: "),
+}
+
+// An output is a stream of the daemon-process output, it is read from the
+// pipe and logged line by line.
+type output struct {
+	stream string
+	reader *os.File
+	writer *os.File
+	daemon string
+	worker string
+	pid    int
+}
+
+// openOutput creates pipes for stdout and stderr of the daemon-process.
+func (d *Context) openOutput() (outputs []*output, err error) {
+	daemon, worker := d.Name, ``
+	if d.Type == `worker` {
+		daemon, worker = d.Parent, d.Name
+	}
+	for _, stream := range []string{StreamStdout, StreamStderr} {
+		o := &output{stream: stream, daemon: daemon, worker: worker}
+		if o.reader, o.writer, err = os.Pipe(); err != nil {
+			closeOutput(outputs)
+			return nil, err
+		}
+		outputs = append(outputs, o)
+	}
+	return
+}
+
+// closeOutput closes pipes of the process which has not been started.
+func closeOutput(outputs []*output) {
+	for _, o := range outputs {
+		_ = o.reader.Close()
+		_ = o.writer.Close()
+	}
+}
+
+// logOutput logs the output of the started process in the background. The
+// returned channel is closed when the output is logged to the end.
+func logOutput(outputs []*output, pid int) <-chan struct{} {
+	var wg sync.WaitGroup
+	for _, o := range outputs {
+		// The write end is kept open only by the process.
+		_ = o.writer.Close()
+		o.pid = pid
+		wg.Add(1)
+		go func(o *output) {
+			defer wg.Done()
+			o.log()
+		}(o)
+	}
+	logged := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(logged)
+	}()
+	return logged
+}
+
+// log logs lines read from the stream until it is closed. Lines written by
+// the logger of the process are passed with the process tags added, other
+// lines are logged with the tags. A panic trace is logged as one event.
+// Results of --once are written to resultOutput.
+func (o *output) log() {
+	defer o.reader.Close()
+	lines := make(chan []byte)
+	go readLines(o.reader, lines)
+	var trace []byte
+	for {
+		var idle <-chan time.Time
+		if trace != nil {
+			idle = time.After(traceIdle)
+		}
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				o.logTrace(trace)
+				return
+			}
+			if trace != nil && !isLogEntry(line) {
+				trace = append(append(trace, '\n'), line...)
+				if len(trace) >= traceSize {
+					o.logTrace(trace)
+					trace = nil
+				}
+				continue
+			}
+			o.logTrace(trace)
+			trace = nil
+			if isTrace(line) {
+				trace = line
+				continue
+			}
+			o.logLine(line)
+		case <-idle:
+			o.logTrace(trace)
+			trace = nil
+		}
+	}
+}
+
+// readLines sends lines read from the stream until it is closed. A line
+// longer than the buffer, e.g. a log entry, is joined up to outputLineSize.
+func readLines(stream io.Reader, lines chan<- []byte) {
+	defer close(lines)
+	reader := bufio.NewReaderSize(stream, outputBufferSize)
+	var line []byte
+	for {
+		fragment, isPrefix, err := reader.ReadLine()
+		if err != nil {
+			if len(line) > 0 {
+				lines <- line
+			}
+			return
+		}
+		line = append(line, fragment...)
+		if isPrefix && len(line) < outputLineSize {
+			continue
+		}
+		lines <- line
+		line = nil
+	}
+}
+
+func (o *output) logLine(line []byte) {
+	if len(bytes.TrimSpace(line)) == 0 {
+		return
+	}
+	if isLogEntry(line) {
+		if isOnceResult(line) {
+			writeResult(line)
+			return
+		}
+		writeLog(append(o.tag(line), '\n'))
+		return
+	}
+	level := zerolog.InfoLevel
+	if o.stream == StreamStderr {
+		level = zerolog.WarnLevel
+	}
+	o.event(level).Msg(string(line))
+}
+
+func (o *output) logTrace(trace []byte) {
+	if trace == nil {
+		return
+	}
+	trace = bytes.TrimRight(trace, "\n")
+	first := trace
+	if i := bytes.IndexByte(trace, '\n'); i >= 0 {
+		first = trace[:i]
+	}
+	o.event(zerolog.ErrorLevel).Str("trace", string(trace)).Msg(string(first))
+}
+
+// tag adds the process tags to the log entry written by the process. Tags
+// already present are kept, so an entry passed by several supervisors is
+// attributed to the process which has written it.
+func (o *output) tag(entry []byte) []byte {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(entry, &fields); err != nil {
+		return entry
+	}
+	var tags []byte
+	add := func(key string, value interface{}) {
+		if _, ok := fields[key]; ok {
+			return
+		}
+		data, _ := json.Marshal(value)
+		tags = append(append(append(tags, ',', '"'), key...), '"', ':')
+		tags = append(tags, data...)
+	}
+	add("daemon", o.daemon)
+	if o.worker != `` {
+		add("worker", o.worker)
+	}
+	add("pid", o.pid)
+	add("stream", o.stream)
+	if tags == nil {
+		return entry
+	}
+	body := bytes.TrimSpace(entry[1:])
+	tagged := append([]byte{'{'}, tags[1:]...)
+	if body[0] != '}' {
+		tagged = append(tagged, ',')
+	}
+	return append(tagged, body...)
+}
+
+func (o *output) event(level zerolog.Level) *zerolog.Event {
+	event := Log().WithLevel(level).Str("daemon", o.daemon)
+	if o.worker != `` {
+		event = event.Str("worker", o.worker)
+	}
+	return event.Int("pid", o.pid).Str("stream", o.stream)
+}
+
+func isTrace(line []byte) bool {
+	for _, prefix := range tracePrefixes {
+		if bytes.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// isLogEntry reports whether the line is written by the logger, or it is
+// the result of --once.
+func isLogEntry(line []byte) bool {
+	return len(line) > 0 && line[0] == '{' && json.Valid(line)
+}
+
+func isOnceResult(line []byte) bool {
+	var result struct {
+		Kind string `json:"kind"`
+	}
+	return json.Unmarshal(line, &result) == nil && result.Kind == OnceResultKind
+}
+
+// writeResult writes the result of --once to resultOutput.
+func writeResult(line []byte) {
+	resultMu.Lock()
+	defer resultMu.Unlock()
+	_, _ = resultOutput.Write(append(line, '\n'))
+}
+
+// waitOutput waits until the output of the exited process is logged, but
+// not longer than outputDrain.
+func waitOutput(logged <-chan struct{}) {
+	select {
+	case <-logged:
+	case <-time.After(outputDrain):
+	}
+}
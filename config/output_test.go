@@ -0,0 +1,99 @@
+package config
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestReadLines(t *testing.T) {
+	long := `{"message":"` + strings.Repeat("x", 3*outputBufferSize) + `"}`
+	tests := []struct {
+		name  string
+		input string
+		want  []int
+	}{
+		{name: "lines", input: "a\nbc\n", want: []int{1, 2}},
+		{name: "last line without newline", input: "a\nbc", want: []int{1, 2}},
+		{name: "line longer than the buffer", input: long + "\na\n", want: []int{len(long), 1}},
+		{
+			name:  "line longer than the limit",
+			input: strings.Repeat("x", outputLineSize+outputBufferSize) + "\n",
+			want:  []int{outputLineSize, outputBufferSize},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines := make(chan []byte)
+			go readLines(bytes.NewBufferString(tt.input), lines)
+			var got []int
+			for line := range lines {
+				got = append(got, len(line))
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("line lengths = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("line lengths = %v, want %v", got, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestOutputLogLine(t *testing.T) {
+	tests := []struct {
+		name   string
+		line   string
+		log    string
+		result string
+	}{
+		{
+			name: "log entry",
+			line: `{"level":"info","message":"done"}`,
+			log:  `{"daemon":"import","worker":"users","pid":42,"stream":"stdout","level":"info","message":"done"}`,
+		},
+		{
+			name: "tags of a nested process",
+			line: `{"level":"info","daemon":"import","worker":"orders","pid":7,"stream":"stderr"}`,
+			log:  `{"level":"info","daemon":"import","worker":"orders","pid":7,"stream":"stderr"}`,
+		},
+		{
+			name: "empty entry",
+			line: `{ }`,
+			log:  `{"daemon":"import","worker":"users","pid":42,"stream":"stdout"}`,
+		},
+		{
+			name:   "once result",
+			line:   `{"kind":"once-result","worker":"users","code":0}`,
+			result: `{"kind":"once-result","worker":"users","code":0}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var log, result bytes.Buffer
+			logMu.Lock()
+			previousTarget := logTarget
+			logTarget = &log
+			logMu.Unlock()
+			previousOutput := resultOutput
+			resultOutput = &result
+			defer func() {
+				logMu.Lock()
+				logTarget = previousTarget
+				logMu.Unlock()
+				resultOutput = previousOutput
+			}()
+			o := &output{stream: StreamStdout, daemon: "import", worker: "users", pid: 42}
+			o.logLine([]byte(tt.line))
+			if got := strings.TrimSuffix(log.String(), "\n"); got != tt.log {
+				t.Errorf("log = %s, want %s", got, tt.log)
+			}
+			if got := strings.TrimSuffix(result.String(), "\n"); got != tt.result {
+				t.Errorf("result = %s, want %s", got, tt.result)
+			}
+		})
+	}
+}
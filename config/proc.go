@@ -0,0 +1,43 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Actions taken when a process exceeds its memory limit.
+const (
+	// MemorySkip makes a worker skip batches while it is over the limit.
+	// It is the default action of workers.
+	MemorySkip = "skip"
+	// MemoryRestart stops the process gracefully and starts it again. It is
+	// the default action of daemons.
+	MemoryRestart = "restart"
+	// MemoryKill kills the process, it is started again by its supervisor.
+	MemoryKill = "kill"
+)
+
+// ProcessMemory returns resident set size of the process in bytes.
+func ProcessMemory(pid int) (rss uint64, err error) {
+	var file *os.File
+	if file, err = os.Open(fmt.Sprintf("/proc/%d/status", pid)); err != nil {
+		return
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "VmRSS:" {
+			if rss, err = strconv.ParseUint(fields[1], 10, 64); err == nil {
+				rss *= 1024
+			}
+			return
+		}
+	}
+	err = scanner.Err()
+	return
+}
@@ -0,0 +1,19 @@
+package config
+
+import (
+	"os"
+	"testing"
+)
+
+func TestProcessMemory(t *testing.T) {
+	rss, err := ProcessMemory(os.Getpid())
+	if err != nil {
+		t.Skip(err)
+	}
+	if rss == 0 || rss%1024 != 0 {
+		t.Errorf("ProcessMemory() = %d, want kilobytes of the test process", rss)
+	}
+	if _, err = ProcessMemory(-1); err == nil {
+		t.Error("ProcessMemory() of a missing process returns no error")
+	}
+}
@@ -0,0 +1,94 @@
+package config
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Restart policies applied by the watcher to supervised daemons and by the
+// import daemon to its workers.
+const (
+	// RestartAlways restarts a daemon whenever it is not running.
+	RestartAlways = "always"
+	// RestartOnFailure restarts a daemon only if it has exited abnormally.
+	RestartOnFailure = "on-failure"
+	// RestartNever starts a daemon once and never restarts it.
+	RestartNever = "never"
+)
+
+// Default backoff settings used when a restart policy leaves them empty.
+const (
+	DefaultRestartBackoff    = time.Second
+	DefaultRestartMaxBackoff = 5 * time.Minute
+	DefaultRestartWindow     = 10 * time.Minute
+)
+
+// A RestartPolicy describes how the watcher restarts a daemon or the import
+// daemon restarts a worker.
+type RestartPolicy struct {
+	// Policy is one of RestartAlways, RestartOnFailure or RestartNever.
+	// Empty value means RestartAlways.
+	Policy string `yaml:"policy" mapstructure:"Policy"`
+	// MaxRestarts is the number of restarts allowed within Window before
+	// the watcher gives up on the daemon. Zero means unlimited.
+	MaxRestarts int `yaml:"max-restarts" mapstructure:"MaxRestarts"`
+	// Window is the period in which restarts are counted.
+	Window time.Duration `yaml:"window" mapstructure:"Window"`
+	// Backoff is the delay before the first restart, doubled on every
+	// following restart within Window.
+	Backoff time.Duration `yaml:"backoff" mapstructure:"Backoff"`
+	// MaxBackoff caps the delay between restarts.
+	MaxBackoff time.Duration `yaml:"max-backoff" mapstructure:"MaxBackoff"`
+	// Jitter is a fraction (0..1) of the delay added or subtracted randomly.
+	Jitter float64 `yaml:"jitter" mapstructure:"Jitter"`
+}
+
+// Name returns the policy name with the default applied.
+func (p RestartPolicy) Name() string {
+	if p.Policy == "" {
+		return RestartAlways
+	}
+	return p.Policy
+}
+
+// Period returns the restarts counting window with the default applied.
+func (p RestartPolicy) Period() time.Duration {
+	if p.Window <= 0 {
+		return DefaultRestartWindow
+	}
+	return p.Window
+}
+
+// Delay returns the backoff before the restart with given attempt number,
+// starting from 1.
+func (p RestartPolicy) Delay(attempt int) time.Duration {
+	backoff, maxBackoff := p.Backoff, p.MaxBackoff
+	if backoff <= 0 {
+		backoff = DefaultRestartBackoff
+	}
+	if maxBackoff <= 0 {
+		maxBackoff = DefaultRestartMaxBackoff
+	}
+	return backoffDelay(backoff, maxBackoff, p.Jitter, attempt)
+}
+
+// backoffDelay returns the backoff doubled for every attempt after the
+// first one and capped by maxBackoff, with the jitter applied.
+func backoffDelay(backoff, maxBackoff time.Duration, jitter float64, attempt int) (delay time.Duration) {
+	if attempt < 1 {
+		attempt = 1
+	}
+	value := float64(backoff) * math.Pow(2, float64(attempt-1))
+	if value > float64(maxBackoff) {
+		value = float64(maxBackoff)
+	}
+	if jitter > 0 {
+		value += value * jitter * (2*rand.Float64() - 1)
+	}
+	delay = time.Duration(value)
+	if delay < 0 {
+		delay = 0
+	}
+	return
+}
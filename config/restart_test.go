@@ -0,0 +1,48 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRestartPolicyDelay(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  RestartPolicy
+		attempt int
+		want    time.Duration
+	}{
+		{name: "default first", attempt: 1, want: DefaultRestartBackoff},
+		{name: "default doubled", attempt: 3, want: 4 * DefaultRestartBackoff},
+		{name: "attempt below one", attempt: 0, want: DefaultRestartBackoff},
+		{name: "default cap", attempt: 20, want: DefaultRestartMaxBackoff},
+		{
+			name:    "configured",
+			policy:  RestartPolicy{Backoff: 100 * time.Millisecond, MaxBackoff: time.Second},
+			attempt: 2,
+			want:    200 * time.Millisecond,
+		},
+		{
+			name:    "configured cap",
+			policy:  RestartPolicy{Backoff: 100 * time.Millisecond, MaxBackoff: time.Second},
+			attempt: 5,
+			want:    time.Second,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.Delay(tt.attempt); got != tt.want {
+				t.Errorf("Delay(%d) = %v, want %v", tt.attempt, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRestartPolicyDelayJitter(t *testing.T) {
+	policy := RestartPolicy{Backoff: time.Second, MaxBackoff: time.Minute, Jitter: 0.5}
+	for i := 0; i < 100; i++ {
+		if got := policy.Delay(2); got < time.Second || got > 3*time.Second {
+			t.Fatalf("Delay(2) = %v, want in range [1s, 3s]", got)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package config
+
+import "time"
+
+// Default backoff settings used when a retry policy leaves them empty.
+const (
+	DefaultRetryBackoff    = 10 * time.Second
+	DefaultRetryMaxBackoff = 10 * time.Minute
+)
+
+// A RetryPolicy describes how a worker retries items returned in
+// ErrorItems of the processing result. Items waiting for retry are kept in
+// memory of the worker process and saved next to its pid file when the
+// worker stops, the next start retries them with their attempts. The
+// checkpoint of the worker is not advanced over the batches of the items
+// until they are saved, so a worker resuming from it fetches them again
+// after a crash. Messages of a queue are acknowledged when their retry is
+// scheduled, they are lost by a crash.
+type RetryPolicy struct {
+	// MaxAttempts is the number of processing attempts of an item, including
+	// the first one, before it is sent to the dead-letter sink. Zero disables
+	// retries and dead-letters.
+	MaxAttempts int `yaml:"max-attempts" mapstructure:"MaxAttempts"`
+	// Backoff is the delay before the first retry, doubled on every
+	// following retry of the item.
+	Backoff time.Duration `yaml:"backoff" mapstructure:"Backoff"`
+	// MaxBackoff caps the delay between retries.
+	MaxBackoff time.Duration `yaml:"max-backoff" mapstructure:"MaxBackoff"`
+	// Jitter is a fraction (0..1) of the delay added or subtracted randomly.
+	Jitter float64 `yaml:"jitter" mapstructure:"Jitter"`
+	// DeadLetter is the path of the JSONL file receiving items which have
+	// exhausted their retries. Defaults to a file next to the pid file.
+	DeadLetter string `yaml:"dead-letter" mapstructure:"DeadLetter"`
+}
+
+// Enabled reports whether failed items are retried.
+func (p RetryPolicy) Enabled() bool {
+	return p.MaxAttempts > 0
+}
+
+// Delay returns the backoff before the retry with given number, starting
+// from 1.
+func (p RetryPolicy) Delay(retry int) time.Duration {
+	backoff, maxBackoff := p.Backoff, p.MaxBackoff
+	if backoff <= 0 {
+		backoff = DefaultRetryBackoff
+	}
+	if maxBackoff <= 0 {
+		maxBackoff = DefaultRetryMaxBackoff
+	}
+	return backoffDelay(backoff, maxBackoff, p.Jitter, retry)
+}
+
+func (p RetryPolicy) validate(path string, errs *ValidationError) {
+	if p.MaxAttempts < 0 {
+		errs.Add(path+".MaxAttempts", "must not be negative")
+	}
+	if p.Backoff < 0 {
+		errs.Add(path+".Backoff", "must not be negative")
+	}
+	if p.MaxBackoff < 0 {
+		errs.Add(path+".MaxBackoff", "must not be negative")
+	}
+	if p.Jitter < 0 || p.Jitter > 1 {
+		errs.Add(path+".Jitter", "must be in range [0, 1]")
+	}
+}
@@ -0,0 +1,75 @@
+package config
+
+import (
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// Overlap policies of scheduled worker runs, applied when a run is due while
+// the previous one is still running.
+const (
+	// OverlapSkip skips the run, it is the default policy.
+	OverlapSkip = "skip"
+	// OverlapQueue starts the run as soon as the previous one is finished.
+	OverlapQueue = "queue"
+	// OverlapAllow starts the run concurrently with the previous one, hooks
+	// of the worker must be safe for concurrent use.
+	OverlapAllow = "allow"
+)
+
+var scheduleParser = cron.NewParser(
+	cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor,
+)
+
+// ParseSchedule parses the cron schedule with 5 fields, or 6 fields starting
+// with seconds, or a descriptor like "@daily" or "@every 1h". Times are
+// computed in the timezone, which may also be given by "CRON_TZ=" prefix of
+// the schedule. The local timezone is used if none is given.
+func ParseSchedule(schedule, timezone string) (cron.Schedule, error) {
+	if timezone != "" && !strings.HasPrefix(schedule, "CRON_TZ=") && !strings.HasPrefix(schedule, "TZ=") {
+		schedule = "CRON_TZ=" + timezone + " " + schedule
+	}
+	return scheduleParser.Parse(schedule)
+}
+
+// A Timer triggers runs of a daemon or a worker every sleep period or by
+// the cron schedule if it is set.
+type Timer struct {
+	schedule cron.Schedule
+	sleep    time.Duration
+}
+
+// NewTimer returns a timer with the schedule, or with the sleep period if
+// the schedule is empty.
+func NewTimer(schedule, timezone string, sleep time.Duration) (timer *Timer, err error) {
+	timer = &Timer{sleep: sleep}
+	if schedule != "" {
+		timer.schedule, err = ParseSchedule(schedule, timezone)
+	}
+	return
+}
+
+// Scheduled reports whether the timer uses a cron schedule.
+func (t *Timer) Scheduled() bool {
+	return t.schedule != nil
+}
+
+// Next returns time of the next run after given time.
+func (t *Timer) Next(after time.Time) time.Time {
+	if t.schedule != nil {
+		return t.schedule.Next(after)
+	}
+	return after.Add(t.sleep)
+}
+
+// C returns a channel receiving time of the next run when it is due.
+func (t *Timer) C() <-chan time.Time {
+	return time.After(time.Until(t.Next(time.Now())))
+}
+
+// Missed reports whether a scheduled run was due between given times.
+func (t *Timer) Missed(from, to time.Time) bool {
+	return t.schedule != nil && !t.Next(from).After(to)
+}
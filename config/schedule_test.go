@@ -0,0 +1,76 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSchedule(t *testing.T) {
+	after := time.Date(2024, 3, 10, 10, 30, 15, 0, time.UTC)
+	tests := []struct {
+		name     string
+		schedule string
+		timezone string
+		want     time.Time
+		wantErr  bool
+	}{
+		{name: "five fields", schedule: "0 12 * * *", timezone: "UTC", want: time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)},
+		{name: "seconds", schedule: "30 * * * * *", timezone: "UTC", want: time.Date(2024, 3, 10, 10, 30, 30, 0, time.UTC)},
+		{name: "descriptor", schedule: "@daily", timezone: "UTC", want: time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC)},
+		{name: "every", schedule: "@every 1h", want: after.Add(time.Hour)},
+		{
+			name:     "timezone",
+			schedule: "0 12 * * *",
+			timezone: "Europe/Moscow",
+			want:     time.Date(2024, 3, 11, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "timezone of the schedule",
+			schedule: "CRON_TZ=Asia/Tokyo 0 12 * * *",
+			timezone: "Europe/Moscow",
+			want:     time.Date(2024, 3, 11, 3, 0, 0, 0, time.UTC),
+		},
+		{name: "invalid", schedule: "* * *", wantErr: true},
+		{name: "unknown timezone", schedule: "@daily", timezone: "Nowhere/City", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := ParseSchedule(tt.schedule, tt.timezone)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSchedule() error = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := schedule.Next(after.In(time.UTC)); !got.Equal(tt.want) {
+				t.Errorf("Next() = %v, want %v", got.UTC(), tt.want)
+			}
+		})
+	}
+}
+
+func TestTimerMissed(t *testing.T) {
+	from := time.Date(2024, 3, 10, 10, 0, 0, 0, time.UTC)
+	scheduled, err := NewTimer("@hourly", "UTC", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sleeping, _ := NewTimer("", "", time.Minute)
+	tests := []struct {
+		name  string
+		timer *Timer
+		to    time.Time
+		want  bool
+	}{
+		{name: "before the run", timer: scheduled, to: from.Add(59 * time.Minute)},
+		{name: "run is due", timer: scheduled, to: from.Add(time.Hour), want: true},
+		{name: "sleep period", timer: sleeping, to: from.Add(time.Hour)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.timer.Missed(from, tt.to); got != tt.want {
+				t.Errorf("Missed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -40,3 +40,47 @@ func FmtDuration(d time.Duration) string {
 	s := d / time.Second
 	return fmt.Sprintf("%02d:%02d:%02d", h, m, s)
 }
+
+// Diff compares exported fields of two structs of the same type and returns
+// descriptions of changed fields in form "Field: old -> new".
+func Diff(old, new interface{}) (changes []string) {
+	oldValue, newValue := reflect.Indirect(reflect.ValueOf(old)), reflect.Indirect(reflect.ValueOf(new))
+	if oldValue.Kind() != reflect.Struct || oldValue.Type() != newValue.Type() {
+		return
+	}
+	for i := 0; i < oldValue.NumField(); i++ {
+		field := oldValue.Type().Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		oldField, newField := oldValue.Field(i).Interface(), newValue.Field(i).Interface()
+		if !reflect.DeepEqual(oldField, newField) {
+			changes = append(changes, fmt.Sprintf("%s: %v -> %v", field.Name, oldField, newField))
+		}
+	}
+	return
+}
+
+// RestartFields are settings of daemons and workers applied only when the
+// process is started.
+var RestartFields = []string{"MemoryCgroup", "Resources", "Health"}
+
+// RestartChanges returns descriptions of changed RestartFields of two
+// structs in form of Diff. The structs may be of different types, fields
+// missing in either of them are skipped.
+func RestartChanges(old, new interface{}) (changes []string) {
+	oldValue, newValue := reflect.Indirect(reflect.ValueOf(old)), reflect.Indirect(reflect.ValueOf(new))
+	if oldValue.Kind() != reflect.Struct || newValue.Kind() != reflect.Struct {
+		return
+	}
+	for _, name := range RestartFields {
+		oldField, newField := oldValue.FieldByName(name), newValue.FieldByName(name)
+		if !oldField.IsValid() || !newField.IsValid() {
+			continue
+		}
+		if !reflect.DeepEqual(oldField.Interface(), newField.Interface()) {
+			changes = append(changes, fmt.Sprintf("%s: %v -> %v", name, oldField.Interface(), newField.Interface()))
+		}
+	}
+	return
+}
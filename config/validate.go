@@ -0,0 +1,240 @@
+package config
+
+import (
+	"github.com/mitchellh/mapstructure"
+
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A FieldError describes a problem with a configuration value.
+type FieldError struct {
+	Path    string
+	Message string
+}
+
+func (e FieldError) Error() string {
+	if e.Path == "" {
+		return e.Message
+	}
+	return e.Path + ": " + e.Message
+}
+
+// A ValidationError aggregates all problems found in a configuration.
+type ValidationError []FieldError
+
+func (e ValidationError) Error() string {
+	lines := make([]string, 0, len(e)+1)
+	lines = append(lines, fmt.Sprintf("config: %d problem(s) found", len(e)))
+	for _, fieldError := range e {
+		lines = append(lines, "  "+fieldError.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Add appends a problem with the value at given path.
+func (e *ValidationError) Add(path string, format string, args ...interface{}) {
+	*e = append(*e, FieldError{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// Err returns nil if there are no problems.
+func (e ValidationError) Err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+// A Validator checks a configuration and adds found problems to errs.
+type Validator func(cfg *Config, errs *ValidationError)
+
+var validators []Validator
+
+// RegisterValidator adds a check performed by Config.Validate, so packages
+// knowing registered daemons and workers can verify references to them.
+func RegisterValidator(validator Validator) {
+	validators = append(validators, validator)
+}
+
+// Validate checks the configuration and returns ValidationError with every
+// problem found.
+func (cfg *Config) Validate() error {
+	var errs ValidationError
+	cfg.validate(&errs)
+	return errs.Err()
+}
+
+func (cfg *Config) validate(errs *ValidationError) {
+	if cfg.PidDir == "" {
+		errs.Add("PidDir", "must not be empty")
+	}
+	if cfg.LogFile != "" && !strings.Contains(cfg.LogFile, LogWorker) {
+		errs.Add("LogFile", "must contain %s, so every process writes its own file", LogWorker)
+	}
+	cfg.LogRotate.validate("LogRotate", errs)
+	if len(cfg.Daemons) > 0 && cfg.Daemon != "" {
+		if _, ok := cfg.Daemons[cfg.Daemon]; !ok {
+			errs.Add("Daemon", "unknown daemon %q", cfg.Daemon)
+		}
+	}
+	for _, name := range cfg.DaemonNames() {
+		daemon := cfg.Daemons[name]
+		path := "Daemons." + name
+		if daemon.Name != "" && daemon.Name != name {
+			errs.Add(path+".Name", "must be equal to the key %q", name)
+		}
+		if daemon.Enabled && daemon.Sleep <= 0 && daemon.Schedule == "" {
+			errs.Add(path+".Sleep", "must be > 0 if Schedule is not set")
+		}
+		validateSchedule(path, daemon.Schedule, daemon.Timezone, errs)
+		if daemon.ShutdownTimeout < 0 {
+			errs.Add(path+".ShutdownTimeout", "must not be negative")
+		}
+		switch daemon.MemoryAction {
+		case "", MemoryRestart, MemoryKill:
+		default:
+			errs.Add(path+".MemoryAction", "must be one of %q or %q", MemoryRestart, MemoryKill)
+		}
+		daemon.Resources.validate(path+".Resources", errs)
+		if daemon.Health.Timeout < 0 {
+			errs.Add(path+".Health.Timeout", "must not be negative")
+		}
+		daemon.Restart.validate(path+".Restart", errs)
+		names := make(map[string]int)
+		for i, worker := range daemon.Workers {
+			workerPath := fmt.Sprintf("%s.Workers[%d]", path, i)
+			if worker.Name == "" {
+				errs.Add(workerPath+".Name", "must not be empty")
+			} else if j, ok := names[worker.Name]; ok {
+				errs.Add(workerPath+".Name", "duplicate of Workers[%d]", j)
+			} else {
+				names[worker.Name] = i
+			}
+			if worker.Sleep < 0 {
+				errs.Add(workerPath+".Sleep", "must not be negative")
+			}
+			validateSchedule(workerPath, worker.Schedule, worker.Timezone, errs)
+			switch worker.Overlap {
+			case "", OverlapSkip, OverlapQueue, OverlapAllow:
+			default:
+				errs.Add(workerPath+".Overlap", "must be one of %q, %q or %q", OverlapSkip, OverlapQueue, OverlapAllow)
+			}
+			if worker.ShutdownTimeout < 0 {
+				errs.Add(workerPath+".ShutdownTimeout", "must not be negative")
+			}
+			switch worker.MemoryAction {
+			case "", MemorySkip, MemoryRestart, MemoryKill:
+			default:
+				errs.Add(workerPath+".MemoryAction", "must be one of %q, %q or %q", MemorySkip, MemoryRestart, MemoryKill)
+			}
+			if worker.Concurrency < 0 {
+				errs.Add(workerPath+".Concurrency", "must not be negative")
+			}
+			if worker.Replicas < 0 {
+				errs.Add(workerPath+".Replicas", "must not be negative")
+			}
+			if worker.Buffer < 0 {
+				errs.Add(workerPath+".Buffer", "must not be negative")
+			}
+			if worker.BatchTimeout < 0 {
+				errs.Add(workerPath+".BatchTimeout", "must not be negative")
+			}
+			worker.Resources.validate(workerPath+".Resources", errs)
+			worker.Retry.validate(workerPath+".Retry", errs)
+			worker.Restart.validate(workerPath+".Restart", errs)
+			if worker.Health.Timeout < 0 {
+				errs.Add(workerPath+".Health.Timeout", "must not be negative")
+			}
+		}
+	}
+	cfg.validateEvents(errs)
+	for _, validator := range validators {
+		validator(cfg, errs)
+	}
+}
+
+func validateSchedule(path, schedule, timezone string, errs *ValidationError) {
+	if timezone != "" {
+		if _, err := time.LoadLocation(timezone); err != nil {
+			errs.Add(path+".Timezone", "%s", err)
+			return
+		}
+	}
+	if schedule != "" {
+		if _, err := ParseSchedule(schedule, timezone); err != nil {
+			errs.Add(path+".Schedule", "%s", err)
+		}
+	}
+}
+
+func (p RestartPolicy) validate(path string, errs *ValidationError) {
+	switch p.Policy {
+	case "", RestartAlways, RestartOnFailure, RestartNever:
+	default:
+		errs.Add(path+".Policy", "must be one of %q, %q or %q", RestartAlways, RestartOnFailure, RestartNever)
+	}
+	if p.MaxRestarts < 0 {
+		errs.Add(path+".MaxRestarts", "must not be negative")
+	}
+	if p.Window < 0 {
+		errs.Add(path+".Window", "must not be negative")
+	}
+	if p.Backoff < 0 {
+		errs.Add(path+".Backoff", "must not be negative")
+	}
+	if p.MaxBackoff < 0 {
+		errs.Add(path+".MaxBackoff", "must not be negative")
+	}
+	if p.Jitter < 0 || p.Jitter > 1 {
+		errs.Add(path+".Jitter", "must be in range [0, 1]")
+	}
+}
+
+// DaemonNames returns names of configured daemons in sorted order.
+func (cfg *Config) DaemonNames() (names []string) {
+	for name := range cfg.Daemons {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return
+}
+
+var (
+	decodeErrorRegexp = regexp.MustCompile(`^(?:error decoding )?'([^']*)':? (.*)$`)
+	unusedKeysRegexp  = regexp.MustCompile(`^has invalid keys: (.*)$`)
+	mapKeyRegexp      = regexp.MustCompile(`\[([^\]]*[^\]0-9][^\]]*)\]`)
+)
+
+// addDecodeErrors converts errors of mapstructure decoder to field errors.
+func (e *ValidationError) addDecodeErrors(err error) {
+	decodeErr, ok := err.(*mapstructure.Error)
+	if !ok {
+		e.Add("", "%s", err)
+		return
+	}
+	messages := append([]string(nil), decodeErr.Errors...)
+	sort.Strings(messages)
+	for _, message := range messages {
+		match := decodeErrorRegexp.FindStringSubmatch(message)
+		if match == nil {
+			e.Add("", "%s", message)
+			continue
+		}
+		if keys := unusedKeysRegexp.FindStringSubmatch(match[2]); keys != nil {
+			for _, key := range strings.Split(keys[1], ", ") {
+				e.Add(fieldPath(match[1]+"."+key), "unknown key")
+			}
+			continue
+		}
+		e.Add(fieldPath(match[1]), "%s", match[2])
+	}
+}
+
+// fieldPath converts mapstructure key path "Daemons[import].Sleep" to
+// "Daemons.import.Sleep".
+func fieldPath(key string) string {
+	return strings.TrimPrefix(mapKeyRegexp.ReplaceAllString(key, ".$1"), ".")
+}
@@ -0,0 +1,122 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func problemPaths(err error) (paths []string) {
+	for _, fieldError := range err.(ValidationError) {
+		paths = append(paths, fieldError.Path)
+	}
+	return
+}
+
+func TestValidate(t *testing.T) {
+	valid := func(change func(cfg *Config)) *Config {
+		cfg := &Config{
+			PidDir: "pids",
+			Daemon: "import",
+			Daemons: map[string]Daemon{
+				"import": {Name: "import", Enabled: true, Sleep: time.Second, Workers: []Worker{{Name: "users"}}},
+			},
+		}
+		if change != nil {
+			change(cfg)
+		}
+		return cfg
+	}
+	withDaemon := func(change func(daemon *Daemon)) func(cfg *Config) {
+		return func(cfg *Config) {
+			daemon := cfg.Daemons["import"]
+			change(&daemon)
+			cfg.Daemons["import"] = daemon
+		}
+	}
+	tests := []struct {
+		name string
+		cfg  *Config
+		want []string
+	}{
+		{name: "valid", cfg: valid(nil)},
+		{name: "empty pid directory", cfg: valid(func(cfg *Config) { cfg.PidDir = "" }), want: []string{"PidDir"}},
+		{name: "shared log file", cfg: valid(func(cfg *Config) { cfg.LogFile = "app.log" }), want: []string{"LogFile"}},
+		{name: "unknown daemon", cfg: valid(func(cfg *Config) { cfg.Daemon = "users" }), want: []string{"Daemon"}},
+		{
+			name: "daemon name",
+			cfg:  valid(withDaemon(func(daemon *Daemon) { daemon.Name = "other" })),
+			want: []string{"Daemons.import.Name"},
+		},
+		{
+			name: "daemon without sleep",
+			cfg:  valid(withDaemon(func(daemon *Daemon) { daemon.Sleep = 0 })),
+			want: []string{"Daemons.import.Sleep"},
+		},
+		{
+			name: "daemon schedule",
+			cfg: valid(withDaemon(func(daemon *Daemon) {
+				daemon.Schedule, daemon.Timezone = "* *", "UTC"
+			})),
+			want: []string{"Daemons.import.Schedule"},
+		},
+		{
+			name: "daemon timezone",
+			cfg:  valid(withDaemon(func(daemon *Daemon) { daemon.Timezone = "Nowhere/City" })),
+			want: []string{"Daemons.import.Timezone"},
+		},
+		{
+			name: "daemon settings",
+			cfg: valid(withDaemon(func(daemon *Daemon) {
+				daemon.ShutdownTimeout = -1
+				daemon.MemoryAction = MemorySkip
+				daemon.Resources.CPU = -1
+				daemon.Restart = RestartPolicy{Policy: "sometimes", Jitter: 2}
+			})),
+			want: []string{
+				"Daemons.import.ShutdownTimeout", "Daemons.import.MemoryAction", "Daemons.import.Resources.CPU",
+				"Daemons.import.Restart.Policy", "Daemons.import.Restart.Jitter",
+			},
+		},
+		{
+			name: "worker names",
+			cfg: valid(withDaemon(func(daemon *Daemon) {
+				daemon.Workers = []Worker{{Name: "users"}, {}, {Name: "users"}}
+			})),
+			want: []string{"Daemons.import.Workers[1].Name", "Daemons.import.Workers[2].Name"},
+		},
+		{
+			name: "worker settings",
+			cfg: valid(withDaemon(func(daemon *Daemon) {
+				daemon.Workers = []Worker{{
+					Name: "users", Sleep: -1, Overlap: "never", Concurrency: -1, Replicas: -1,
+					Buffer: -1, BatchTimeout: -1, Retry: RetryPolicy{MaxAttempts: -1},
+					Restart: RestartPolicy{Policy: "sometimes"},
+				}}
+			})),
+			want: []string{
+				"Daemons.import.Workers[0].Sleep", "Daemons.import.Workers[0].Overlap",
+				"Daemons.import.Workers[0].Concurrency", "Daemons.import.Workers[0].Replicas",
+				"Daemons.import.Workers[0].Buffer", "Daemons.import.Workers[0].BatchTimeout",
+				"Daemons.import.Workers[0].Retry.MaxAttempts", "Daemons.import.Workers[0].Restart.Policy",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Validate()
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("Validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Validate() error = nil, want problems of %q", tt.want)
+			}
+			if got := problemPaths(err); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Validate() problems = %q, want %q\n%v", got, tt.want, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,308 @@
+package daemons
+
+import (
+	"github.com/phantom-d/go-daemons/config"
+
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Control commands accepted by the watcher.
+const (
+	CommandStatus  = "status"
+	CommandStart   = "start"
+	CommandStop    = "stop"
+	CommandRestart = "restart"
+	CommandReload  = "reload"
+)
+
+// ControlTimeout limits time of a control command round trip.
+var ControlTimeout = 30 * time.Second
+
+// A ControlRequest is sent to the control socket as a single JSON line.
+// Target is a daemon name or "<daemon>/<worker>".
+type ControlRequest struct {
+	Command string `json:"command"`
+	Target  string `json:"target,omitempty"`
+}
+
+// A ControlResponse is returned from the control socket as a single JSON line.
+type ControlResponse struct {
+	Ok    bool            `json:"ok"`
+	Error string          `json:"error,omitempty"`
+	Data  json.RawMessage `json:"data,omitempty"`
+}
+
+// A Controller handles commands received on the control socket. Start
+// serves the control socket for daemons implementing Controller, commands
+// are handled in the daemon loop between runs.
+type Controller interface {
+	Control(request ControlRequest) (data interface{}, err error)
+}
+
+type controlCall struct {
+	request ControlRequest
+	reply   chan ControlResponse
+}
+
+// Command sends the control command with optional target to the running
+// watcher and writes the result to w. It serves the --signal flag, see Main:
+// status, start <daemon>, stop <daemon>/<worker>, restart, reload. Status is
+// written as a table, or as JSON with the "--format=json" flag. The enqueue
+// <worker> <payload> subcommand is run by Enqueue, logs <worker> [-f] by
+// Logs.
+func Command(w io.Writer, command string, args ...string) (err error) {
+	switch command {
+	case CommandEnqueue:
+		if len(args) == 0 {
+			return Enqueue(w, ``)
+		}
+		return Enqueue(w, args[0], args[1:]...)
+	case CommandLogs:
+		if len(args) == 0 {
+			return Logs(w, ``)
+		}
+		return Logs(w, args[0])
+	}
+	request := ControlRequest{Command: command}
+	if len(args) > 0 {
+		request.Target = args[0]
+	}
+	var response ControlResponse
+	if response, err = Dial(request); err != nil {
+		return
+	}
+	if !response.Ok {
+		return fmt.Errorf("daemon: %s: %s", command, response.Error)
+	}
+	switch {
+	case command == CommandStatus && config.Cfg().Format != "json":
+		var statuses map[string]DaemonStatus
+		if err = json.Unmarshal(response.Data, &statuses); err != nil {
+			return
+		}
+		err = WriteStatus(w, statuses)
+	case len(response.Data) > 0:
+		_, err = fmt.Fprintln(w, string(response.Data))
+	default:
+		_, err = fmt.Fprintln(w, "OK")
+	}
+	return
+}
+
+// Dial sends the request to the control socket of the running watcher.
+func Dial(request ControlRequest) (response ControlResponse, err error) {
+	var conn net.Conn
+	if conn, err = net.DialTimeout("unix", config.SocketPath(), ControlTimeout); err != nil {
+		return
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(ControlTimeout))
+	if err = json.NewEncoder(conn).Encode(request); err != nil {
+		return
+	}
+	err = json.NewDecoder(conn).Decode(&response)
+	return
+}
+
+// listenControl serves the control socket until the returned close
+// function is called.
+func (dd *DaemonData) listenControl() (closeControl func(), err error) {
+	path := config.SocketPath()
+	if err = os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	var listener net.Listener
+	if listener, err = net.Listen("unix", path); err != nil {
+		return
+	}
+	if err = os.Chmod(path, 0600); err != nil {
+		_ = listener.Close()
+		return
+	}
+	dd.controls = make(chan controlCall)
+	config.Log().Debug().Msgf("Daemon '%s' listen control socket '%s'", dd.Name, path)
+	closeControl = func() {
+		_ = listener.Close()
+		_ = os.Remove(path)
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				if errors.Is(err, net.ErrClosed) {
+					return
+				}
+				config.Log().Error().Err(err).Msgf("Daemon '%s' control socket", dd.Name)
+				continue
+			}
+			go dd.serveControl(conn)
+		}
+	}()
+	return
+}
+
+func (dd *DaemonData) serveControl(conn net.Conn) {
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(ControlTimeout))
+	var (
+		request  ControlRequest
+		response ControlResponse
+	)
+	line, err := bufio.NewReader(conn).ReadBytes('\n')
+	if err == nil {
+		err = json.Unmarshal(line, &request)
+	}
+	if err != nil {
+		response.Error = err.Error()
+	} else {
+		call := controlCall{request: request, reply: make(chan ControlResponse, 1)}
+		select {
+		case dd.controls <- call:
+			response = <-call.reply
+		case <-dd.done:
+			response.Error = "daemon is stopping"
+		}
+	}
+	if err = json.NewEncoder(conn).Encode(response); err != nil {
+		config.Log().Error().Err(err).Msgf("Daemon '%s' control socket", dd.Name)
+	}
+}
+
+// control runs the request on the controller and makes the response.
+func control(controller Controller, request ControlRequest) (response ControlResponse) {
+	config.Log().Info().Msgf("Control command '%s' %s", request.Command, request.Target)
+	data, err := controller.Control(request)
+	if err != nil {
+		response.Error = err.Error()
+		return
+	}
+	if data != nil {
+		if response.Data, err = json.Marshal(data); err != nil {
+			response.Error = err.Error()
+			return
+		}
+	}
+	response.Ok = true
+	return
+}
+
+// Control handles commands of the control socket. Stopped daemons and
+// workers are held, so they are not started again until the start command.
+func (watcher *Watcher) Control(request ControlRequest) (data interface{}, err error) {
+	daemonName, workerName := splitTarget(request.Target)
+	switch request.Command {
+	case CommandStatus:
+		var result []byte
+		if result, err = DaemonsStatus(daemonName); err == nil {
+			data = json.RawMessage(result)
+		}
+		return
+	case CommandReload:
+		reload(watcher)
+		return nil, watcher.Run()
+	case CommandStart, CommandStop, CommandRestart:
+	default:
+		return nil, fmt.Errorf("unknown command %q", request.Command)
+	}
+	if daemonName == `` {
+		return nil, fmt.Errorf("command %q requires a target", request.Command)
+	}
+	if !inWorkers(watcher.Workers, daemonName) {
+		return nil, fmt.Errorf("unknown daemon %q", daemonName)
+	}
+	if workerName != `` {
+		return nil, watcher.controlWorker(request.Command, daemonName, workerName)
+	}
+	ctx := daemonContext(daemonName)
+	rs := watcher.restartState(daemonName)
+	switch request.Command {
+	case CommandStop:
+		if err = ctx.Hold(); err != nil {
+			return
+		}
+		rs.State = StateStopped
+		watcher.stop(daemonName, ctx)
+	case CommandStart, CommandRestart:
+		if err = ctx.Unhold(); err != nil {
+			return
+		}
+		if running, _ := watcher.alive(daemonName, ctx); running {
+			if request.Command == CommandStart {
+				return
+			}
+			watcher.stop(daemonName, ctx)
+		}
+		// Started by operator, so backoff and give up state are dropped.
+		rs.State = ``
+	}
+	if err = rs.Save(); err != nil {
+		return
+	}
+	return nil, watcher.Run()
+}
+
+// controlWorker handles the command for the worker replica given by its
+// name or for every replica given by the worker name.
+func (watcher *Watcher) controlWorker(command, daemonName, workerName string) (err error) {
+	daemon, ok := config.Cfg().Daemons[daemonName]
+	var names []string
+	for _, worker := range daemon.Workers {
+		for _, name := range replicaNames(worker, true) {
+			if worker.Name == workerName || name == workerName {
+				names = append(names, name)
+			}
+		}
+	}
+	if !ok || len(names) == 0 {
+		return fmt.Errorf("unknown worker %q of daemon %q", workerName, daemonName)
+	}
+	timeout := daemon.ShutdownTimeout
+	if timeout <= 0 {
+		timeout = config.DefaultShutdownTimeout
+	}
+	var children []childProcess
+	for _, name := range names {
+		ctx := workerContext(daemonName, name)
+		switch command {
+		case CommandStop:
+			err = ctx.Hold()
+		case CommandStart, CommandRestart:
+			err = ctx.Unhold()
+		}
+		if err != nil {
+			return
+		}
+		if command == CommandStart {
+			continue
+		}
+		var process *os.Process
+		if process, err = ctx.Search(); err != nil {
+			return
+		}
+		if process != nil {
+			children = append(children, childProcess{name: name, process: process})
+		}
+	}
+	if len(children) > 0 {
+		go terminate(children, syscall.SIGTERM, timeout)
+	}
+	return
+}
+
+func splitTarget(target string) (daemon string, worker string) {
+	parts := strings.SplitN(target, "/", 2)
+	daemon = parts[0]
+	if len(parts) > 1 {
+		worker = parts[1]
+	}
+	return
+}
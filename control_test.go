@@ -0,0 +1,135 @@
+package daemons
+
+import (
+	"github.com/phantom-d/go-daemons/config"
+
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// testController echoes the target of the start command and fails the stop
+// command.
+type testController struct{}
+
+func (testController) Control(request ControlRequest) (data interface{}, err error) {
+	switch request.Command {
+	case CommandStart:
+		return map[string]string{"started": request.Target}, nil
+	case CommandStop:
+		return nil, errors.New("unknown daemon")
+	}
+	return
+}
+
+func TestControlSocket(t *testing.T) {
+	defer func(cfg config.Config) { *config.Cfg() = cfg }(*config.Cfg())
+	config.Cfg().PidDir = t.TempDir()
+	dd := &DaemonData{Name: "watcher", done: make(chan struct{})}
+	closeControl, err := dd.listenControl()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeControl()
+	defer close(dd.done)
+	go func() {
+		for {
+			select {
+			case call := <-dd.controls:
+				call.reply <- control(testController{}, call.request)
+			case <-dd.done:
+				return
+			}
+		}
+	}()
+	tests := []struct {
+		command string
+		args    []string
+		want    string
+		err     string
+	}{
+		{command: CommandReload, want: "OK\n"},
+		{command: CommandStart, args: []string{"import"}, want: `{"started":"import"}` + "\n"},
+		{command: CommandStop, args: []string{"users"}, err: "daemon: stop: unknown daemon"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			var out bytes.Buffer
+			err := Command(&out, tt.command, tt.args...)
+			if tt.err != `` {
+				if err == nil || err.Error() != tt.err {
+					t.Errorf("Command() error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != tt.want {
+				t.Errorf("Command() output = %q, want %q", out.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestWatcherControl(t *testing.T) {
+	defer func(cfg config.Config) { *config.Cfg() = cfg }(*config.Cfg())
+	config.Cfg().PidDir = t.TempDir()
+	config.Cfg().Daemons = map[string]config.Daemon{
+		"import": {Enabled: true, Workers: []config.Worker{{Name: "w", Enabled: true, Replicas: 2}}},
+	}
+	watcher := &Watcher{&DaemonData{Name: "watcher", Workers: []config.Worker{{Name: "import"}}}}
+	tests := []struct {
+		name    string
+		request ControlRequest
+		err     string
+	}{
+		{name: "unknown command", request: ControlRequest{Command: "pause", Target: "import"}, err: `unknown command "pause"`},
+		{name: "no target", request: ControlRequest{Command: CommandStop}, err: `command "stop" requires a target`},
+		{name: "unknown daemon", request: ControlRequest{Command: CommandStop, Target: "users"}, err: `unknown daemon "users"`},
+		{
+			name:    "unknown worker",
+			request: ControlRequest{Command: CommandStop, Target: "import/users"},
+			err:     `unknown worker "users" of daemon "import"`,
+		},
+		{name: "stop worker", request: ControlRequest{Command: CommandStop, Target: "import/w"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := watcher.Control(tt.request)
+			if tt.err == `` && err != nil || tt.err != `` && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Errorf("Control() error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+
+	// Every replica of the stopped worker is held until it is started.
+	for _, name := range []string{"w", "w_1"} {
+		if !workerContext("import", name).Held() {
+			t.Errorf("replica '%s' is not held after stop", name)
+		}
+	}
+	if _, err := watcher.Control(ControlRequest{Command: CommandStart, Target: "import/w_1"}); err != nil {
+		t.Fatal(err)
+	}
+	if workerContext("import", "w_1").Held() || !workerContext("import", "w").Held() {
+		t.Error("start of the replica does not release only its hold")
+	}
+}
+
+func TestSplitTarget(t *testing.T) {
+	tests := []struct {
+		target, daemon, worker string
+	}{
+		{target: "import", daemon: "import"},
+		{target: "import/users", daemon: "import", worker: "users"},
+		{target: "import/users/1", daemon: "import", worker: "users/1"},
+		{},
+	}
+	for _, tt := range tests {
+		if daemon, worker := splitTarget(tt.target); daemon != tt.daemon || worker != tt.worker {
+			t.Errorf("splitTarget(%q) = %q, %q, want %q, %q", tt.target, daemon, worker, tt.daemon, tt.worker)
+		}
+	}
+}
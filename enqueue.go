@@ -0,0 +1,102 @@
+package daemons
+
+import (
+	"github.com/phantom-d/go-daemons/config"
+	"github.com/phantom-d/go-daemons/imports"
+
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// CommandEnqueue publishes messages to the queue backend of a worker. It is
+// handled by the command line process, the watcher need not be running.
+const CommandEnqueue = "enqueue"
+
+// Enqueue publishes payloads to the queue backend of the worker given by
+// target, "<daemon>/<worker>" or a worker name unique among daemons. If the
+// payload is "-", every line read from stdin is published.
+func Enqueue(w io.Writer, target string, payloads ...string) (err error) {
+	if target == `` || len(payloads) == 0 {
+		return errors.New("usage: -s enqueue <worker> <payload>")
+	}
+	var (
+		cfg    config.Worker
+		parent string
+	)
+	if cfg, parent, err = targetWorker(target); err != nil {
+		return
+	}
+	worker := &imports.Worker{Name: cfg.Name, Queue: cfg.Queue, Parent: parent}
+	var bodies [][]byte
+	for _, payload := range payloads {
+		if payload != "-" {
+			bodies = append(bodies, []byte(payload))
+			continue
+		}
+		reader := bufio.NewReader(os.Stdin)
+		for {
+			line, readErr := reader.ReadBytes('\n')
+			if len(line) > 0 && line[len(line)-1] == '\n' {
+				line = line[:len(line)-1]
+			}
+			if len(line) > 0 {
+				bodies = append(bodies, line)
+			}
+			if readErr == io.EOF {
+				break
+			}
+			if readErr != nil {
+				return readErr
+			}
+		}
+	}
+	var queue imports.Queue
+	if queue, err = imports.OpenQueue(worker); err != nil {
+		return
+	}
+	if queue == nil {
+		return fmt.Errorf("worker %q has no queue backend", target)
+	}
+	defer queue.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), ControlTimeout)
+	defer cancel()
+	if err = queue.Publish(ctx, bodies...); err != nil {
+		return
+	}
+	_, err = fmt.Fprintf(w, "%d message(s) enqueued\n", len(bodies))
+	return
+}
+
+// targetWorker returns configuration of the worker given by target,
+// "<daemon>/<worker>" or a worker name unique among daemons, and the name of
+// its daemon.
+func targetWorker(target string) (worker config.Worker, parent string, err error) {
+	daemonName, workerName := splitTarget(target)
+	if workerName == `` {
+		daemonName, workerName = ``, daemonName
+	}
+	for _, name := range config.Cfg().DaemonNames() {
+		if daemonName != `` && name != daemonName {
+			continue
+		}
+		for _, cfg := range config.Cfg().Daemons[name].Workers {
+			if cfg.Name != workerName || imports.Factory.CreateInstance(cfg.Name) == nil {
+				continue
+			}
+			if parent != `` {
+				err = fmt.Errorf("worker %q is configured in daemons '%s' and '%s', use <daemon>/<worker>",
+					workerName, parent, name)
+				return
+			}
+			worker, parent = cfg, name
+		}
+	}
+	if parent == `` {
+		err = fmt.Errorf("unknown worker %q", target)
+	}
+	return
+}
@@ -0,0 +1,105 @@
+package daemons
+
+import (
+	"github.com/phantom-d/go-daemons/config"
+	"github.com/phantom-d/go-daemons/imports"
+
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEnqueue(t *testing.T) {
+	defer func(cfg config.Config) { *config.Cfg() = cfg }(*config.Cfg())
+	imports.Factory.RegisterContext("test-enqueue", func() imports.ContextWorker { return &imports.PipelineWorker[string]{} })
+	defer delete(imports.Factory, "test-enqueue")
+	imports.Factory.RegisterContext("test-no-queue", func() imports.ContextWorker { return &imports.PipelineWorker[string]{} })
+	defer delete(imports.Factory, "test-no-queue")
+	config.Cfg().Daemons = map[string]config.Daemon{
+		"import": {Workers: []config.Worker{
+			{Name: "test-enqueue", Queue: "memory://enqueue-import"},
+			{Name: "test-no-queue"},
+		}},
+		"export": {Workers: []config.Worker{{Name: "test-enqueue", Queue: "memory://enqueue-export"}}},
+		"users":  {Workers: []config.Worker{{Name: "test-unknown", Queue: "memory://enqueue-users"}}},
+	}
+
+	stdin := filepath.Join(t.TempDir(), "stdin")
+	if err := os.WriteFile(stdin, []byte("line 1\n\nline 2"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		target   string
+		payloads []string
+		queue    string
+		want     []string
+		err      string
+	}{
+		{name: "no payload", target: "import/test-enqueue", err: "usage: -s enqueue <worker> <payload>"},
+		{name: "unknown worker", target: "import/users", payloads: []string{"{}"}, err: `unknown worker "import/users"`},
+		{name: "unregistered worker", target: "test-unknown", payloads: []string{"{}"}, err: `unknown worker "test-unknown"`},
+		{
+			name:     "ambiguous worker",
+			target:   "test-enqueue",
+			payloads: []string{"{}"},
+			err:      `worker "test-enqueue" is configured in daemons 'export' and 'import', use <daemon>/<worker>`,
+		},
+		{name: "no queue", target: "test-no-queue", payloads: []string{"{}"}, err: `worker "test-no-queue" has no queue backend`},
+		{
+			name:     "payloads",
+			target:   "import/test-enqueue",
+			payloads: []string{`{"id":1}`, `{"id":2}`},
+			queue:    "enqueue-import",
+			want:     []string{`{"id":1}`, `{"id":2}`},
+		},
+		{
+			name:     "stdin",
+			target:   "export/test-enqueue",
+			payloads: []string{"-", "last"},
+			queue:    "enqueue-export",
+			want:     []string{"line 1", "line 2", "last"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, err := os.Open(stdin)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer file.Close()
+			defer func(stdin *os.File) { os.Stdin = stdin }(os.Stdin)
+			os.Stdin = file
+
+			var out bytes.Buffer
+			err = Enqueue(&out, tt.target, tt.payloads...)
+			if tt.err != `` {
+				if err == nil || err.Error() != tt.err {
+					t.Errorf("Enqueue() error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := fmt.Sprintf("%d message(s) enqueued\n", len(tt.want)); out.String() != want {
+				t.Errorf("Enqueue() output = %q, want %q", out.String(), want)
+			}
+			messages, err := imports.NewMemoryQueue(tt.queue).Consume(context.Background(), 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var bodies []string
+			for _, message := range messages {
+				bodies = append(bodies, string(message.Body))
+			}
+			if strings.Join(bodies, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("enqueued %q, want %q", bodies, tt.want)
+			}
+		})
+	}
+}
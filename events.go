@@ -0,0 +1,223 @@
+package daemons
+
+import (
+	"github.com/phantom-d/go-daemons/config"
+
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// An Event is a lifecycle transition of a daemon or worker process emitted
+// by its supervisor: the watcher for daemons, the import daemon for workers.
+// Subscribers distinguish events by type:
+//
+//	daemons.Subscribe(func(event daemons.Event) {
+//		if exited, ok := event.(*daemons.Exited); ok && exited.Code != 0 {
+//			...
+//		}
+//	})
+type Event interface {
+	// Event returns the name of the event, one of config.Event* constants.
+	Event() string
+	// Source returns the process the event is about.
+	Source() EventSource
+}
+
+// An EventSource describes the process of the event.
+type EventSource struct {
+	Name string    `json:"name"`
+	Type string    `json:"type"`
+	Pid  int       `json:"pid,omitempty"`
+	Time time.Time `json:"time"`
+}
+
+func (s EventSource) Source() EventSource {
+	return s
+}
+
+// Spawned is emitted when the supervisor has started the process.
+type Spawned struct {
+	EventSource
+}
+
+func (*Spawned) Event() string {
+	return config.EventSpawned
+}
+
+// Exited is emitted when the supervisor has reaped the process.
+type Exited struct {
+	EventSource
+	Code   int           `json:"code"`
+	Signal string        `json:"signal,omitempty"`
+	Error  string        `json:"error,omitempty"`
+	Uptime time.Duration `json:"uptime"`
+}
+
+func (*Exited) Event() string {
+	return config.EventExited
+}
+
+// Restarting is emitted when the restart of the process is scheduled after
+// Delay, Restarts is the number of the restart.
+type Restarting struct {
+	EventSource
+	Delay    time.Duration `json:"delay"`
+	Restarts int           `json:"restarts"`
+}
+
+func (*Restarting) Event() string {
+	return config.EventRestarting
+}
+
+// BackoffGiveUp is emitted when the process has been restarted MaxRestarts
+// times within the restart window and is not started again.
+type BackoffGiveUp struct {
+	EventSource
+	Restarts int           `json:"restarts"`
+	Window   time.Duration `json:"window"`
+}
+
+func (*BackoffGiveUp) Event() string {
+	return config.EventBackoffGiveUp
+}
+
+// MemoryExceeded is emitted when the process has exceeded its memory limit,
+// Action is applied to it.
+type MemoryExceeded struct {
+	EventSource
+	RSS    uint64 `json:"rss"`
+	Limit  uint64 `json:"limit"`
+	Action string `json:"action"`
+}
+
+func (*MemoryExceeded) Event() string {
+	return config.EventMemoryExceeded
+}
+
+// ConfigReloaded is emitted by a daemon which has reloaded the
+// configuration, Changes are its changed settings.
+type ConfigReloaded struct {
+	EventSource
+	Changes []string `json:"changes,omitempty"`
+}
+
+func (*ConfigReloaded) Event() string {
+	return config.EventConfigReloaded
+}
+
+var (
+	subscribersMu sync.RWMutex
+	subscribers   = map[int]func(Event){}
+	subscriberSeq int
+)
+
+// Subscribe registers fn called on every event emitted by the process, it
+// is called synchronously from the daemon loop and must not block. Daemons
+// run as separate processes, so subscribers are registered in each of them.
+// Returns the function removing the subscriber.
+func Subscribe(fn func(Event)) (unsubscribe func()) {
+	subscribersMu.Lock()
+	defer subscribersMu.Unlock()
+	subscriberSeq++
+	id := subscriberSeq
+	subscribers[id] = fn
+	return func() {
+		subscribersMu.Lock()
+		defer subscribersMu.Unlock()
+		delete(subscribers, id)
+	}
+}
+
+// emit passes the event to the subscribers and starts hooks configured for
+// it in the background.
+func emit(event Event) {
+	source := event.Source()
+	config.Log().Debug().Str("name", source.Name).Str("type", source.Type).Msgf("Event '%s'", event.Event())
+	subscribersMu.RLock()
+	fns := make([]func(Event), 0, len(subscribers))
+	for _, fn := range subscribers {
+		fns = append(fns, fn)
+	}
+	subscribersMu.RUnlock()
+	for _, fn := range fns {
+		fn(event)
+	}
+	for _, hook := range config.Cfg().EventHooks(event.Event()) {
+		go runHook(hook, event)
+	}
+}
+
+func newSource(name string, ctx *config.Context, pid int) EventSource {
+	return EventSource{Name: name, Type: ctx.Type, Pid: pid, Time: time.Now()}
+}
+
+// runHook runs the command and posts the event to the URL of the hook.
+func runHook(hook config.EventHook, event Event) {
+	source := event.Source()
+	payload, err := eventPayload(event)
+	if err != nil {
+		config.Log().Error().Err(err).Msgf("Event '%s' of '%s'", event.Event(), source.Name)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), hook.Deadline())
+	defer cancel()
+	if hook.Command != `` {
+		cmd := exec.CommandContext(ctx, "/bin/sh", "-c", hook.Command)
+		cmd.Stdin = bytes.NewReader(payload)
+		cmd.Env = append(os.Environ(),
+			"GO_DAEMONS_EVENT="+event.Event(),
+			"GO_DAEMONS_EVENT_NAME="+source.Name,
+			"GO_DAEMONS_EVENT_TYPE="+source.Type,
+			"GO_DAEMONS_EVENT_PID="+strconv.Itoa(source.Pid),
+		)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			config.Log().Error().Err(err).Bytes("output", output).
+				Msgf("Event '%s' of '%s' command", event.Event(), source.Name)
+		}
+	}
+	if hook.URL != `` {
+		if err = postEvent(ctx, hook.URL, payload); err != nil {
+			config.Log().Error().Err(err).Msgf("Event '%s' of '%s' webhook", event.Event(), source.Name)
+		}
+	}
+}
+
+// eventPayload returns the event as a JSON object with its name in the
+// "event" field.
+func eventPayload(event Event) (payload []byte, err error) {
+	var data []byte
+	if data, err = json.Marshal(event); err != nil {
+		return
+	}
+	fields := make(map[string]interface{})
+	if err = json.Unmarshal(data, &fields); err != nil {
+		return
+	}
+	fields["event"] = event.Event()
+	return json.Marshal(fields)
+}
+
+func postEvent(ctx context.Context, url string, payload []byte) (err error) {
+	var request *http.Request
+	if request, err = http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload)); err != nil {
+		return
+	}
+	request.Header.Set("Content-Type", "application/json")
+	var response *http.Response
+	if response, err = http.DefaultClient.Do(request); err != nil {
+		return
+	}
+	defer response.Body.Close()
+	if response.StatusCode >= http.StatusMultipleChoices {
+		err = fmt.Errorf("unexpected status %s", response.Status)
+	}
+	return
+}
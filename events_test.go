@@ -0,0 +1,97 @@
+package daemons
+
+import (
+	"github.com/phantom-d/go-daemons/config"
+
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSubscribe(t *testing.T) {
+	defer func(cfg config.Config) { *config.Cfg() = cfg }(*config.Cfg())
+	config.Cfg().Events = nil
+	var events []Event
+	unsubscribe := Subscribe(func(event Event) { events = append(events, event) })
+	emit(&Spawned{EventSource: EventSource{Name: "import", Type: `daemon`, Pid: 10}})
+	unsubscribe()
+	emit(&Exited{EventSource: EventSource{Name: "import", Type: `daemon`, Pid: 10}})
+	if len(events) != 1 || events[0].Event() != config.EventSpawned || events[0].Source().Pid != 10 {
+		t.Errorf("events = %+v, want only the spawned event", events)
+	}
+}
+
+func TestEventPayload(t *testing.T) {
+	started := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	payload, err := eventPayload(&Exited{
+		EventSource: EventSource{Name: "users", Type: `worker`, Pid: 42, Time: started},
+		Code:        -1,
+		Signal:      "killed",
+		Uptime:      time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"code":-1,"event":"exited","name":"users","pid":42,"signal":"killed","time":"2024-01-02T03:04:05Z","type":"worker","uptime":1000000000}`
+	if string(payload) != want {
+		t.Errorf("eventPayload() = %s, want %s", payload, want)
+	}
+}
+
+func TestRunHook(t *testing.T) {
+	if _, err := os.Stat("/bin/sh"); err != nil {
+		t.Skip(err)
+	}
+	posted := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		posted <- r.Header.Get("Content-Type") + " " + string(body)
+	}))
+	defer server.Close()
+	output := filepath.Join(t.TempDir(), "event")
+	hook := config.EventHook{
+		Command: `{ echo "$GO_DAEMONS_EVENT $GO_DAEMONS_EVENT_NAME $GO_DAEMONS_EVENT_TYPE $GO_DAEMONS_EVENT_PID"; cat; } > ` + output,
+		URL:     server.URL,
+	}
+	event := &Restarting{EventSource: EventSource{Name: "users", Type: `worker`, Pid: 42}, Delay: time.Second, Restarts: 3}
+	runHook(hook, event)
+
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env, stdin, _ := strings.Cut(string(data), "\n")
+	if env != "restarting users worker 42" {
+		t.Errorf("command environment = %q", env)
+	}
+	var fields map[string]interface{}
+	if err = json.Unmarshal([]byte(stdin), &fields); err != nil || fields["event"] != config.EventRestarting || fields["restarts"] != 3.0 {
+		t.Errorf("command stdin = %q, %v, want the event", stdin, err)
+	}
+	select {
+	case body := <-posted:
+		if !strings.HasPrefix(body, `application/json {`) || !strings.Contains(body, `"event":"restarting"`) {
+			t.Errorf("posted %q, want the event as JSON", body)
+		}
+	default:
+		t.Error("the event is not posted")
+	}
+}
+
+func TestPostEventStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+	err := postEvent(context.Background(), server.URL, []byte(`{}`))
+	if err == nil || !strings.Contains(err.Error(), "500") {
+		t.Errorf("postEvent() error = %v, want the status", err)
+	}
+}
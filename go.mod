@@ -1,10 +1,15 @@
 module github.com/phantom-d/go-daemons
 
-go 1.17
+go 1.18
 
 require (
 	github.com/mitchellh/mapstructure v1.4.3
 	github.com/rs/zerolog v1.26.1
 )
 
-require github.com/spf13/pflag v1.0.5 // indirect
+require (
+	github.com/BurntSushi/toml v1.2.1
+	github.com/robfig/cron/v3 v3.0.1
+	github.com/spf13/pflag v1.0.5
+	gopkg.in/yaml.v3 v3.0.1
+)
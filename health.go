@@ -0,0 +1,45 @@
+package daemons
+
+import (
+	"github.com/phantom-d/go-daemons/config"
+)
+
+// A ReadinessChecker is implemented by daemons which check their
+// dependencies. It is called on every tick of the daemon serving health
+// checks, the result is reported by the readiness endpoint.
+type ReadinessChecker interface {
+	Ready() error
+}
+
+// serveHealth serves health checks of the daemon if they are configured.
+// The returned close function is never nil.
+func (dd *DaemonData) serveHealth() (closeHealth func()) {
+	closeHealth = func() {}
+	if dd.Health.Listen == `` {
+		return
+	}
+	dd.health = config.NewHealth(dd.Name, dd.Health, dd.Sleep)
+	var err error
+	if closeHealth, err = dd.health.Serve(dd.Health.Listen); err != nil {
+		config.Log().Error().Err(err).Msgf("Daemon '%s' health endpoint", dd.Name)
+		dd.health = nil
+		closeHealth = func() {}
+	}
+	return
+}
+
+// heartbeat records a tick of the daemon loop and checks readiness of the
+// daemon.
+func (dd *DaemonData) heartbeat(d DaemonInterface) {
+	if dd.health == nil {
+		return
+	}
+	dd.health.Tick()
+	var err error
+	if checker, ok := d.(ReadinessChecker); ok {
+		if err = checker.Ready(); err != nil {
+			config.Log().Warn().Err(err).Msgf("Daemon '%s' is not ready", dd.Name)
+		}
+	}
+	dd.health.SetReady(err)
+}
@@ -0,0 +1,46 @@
+package daemons
+
+import (
+	"github.com/phantom-d/go-daemons/config"
+
+	"errors"
+	"testing"
+	"time"
+)
+
+// testReadyDaemon reports the readiness error.
+type testReadyDaemon struct {
+	Watcher
+	err error
+}
+
+func (d *testReadyDaemon) Ready() error {
+	return d.err
+}
+
+func TestHeartbeat(t *testing.T) {
+	tests := []struct {
+		name  string
+		err   error
+		ready bool
+	}{
+		{name: "ready", ready: true},
+		{name: "not ready", err: errors.New("no database")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dd := &DaemonData{Name: "import", health: config.NewHealth("import", config.HealthCheck{}, time.Second)}
+			d := &testReadyDaemon{Watcher: Watcher{dd}, err: tt.err}
+			dd.heartbeat(d)
+			if err := dd.health.Ready(); (err == nil) != tt.ready || err != nil && err != tt.err {
+				t.Errorf("Ready() = %v, want ready %v", err, tt.ready)
+			}
+		})
+	}
+	// Daemons without health checks are not checked.
+	dd := &DaemonData{Name: "import"}
+	dd.heartbeat(&testReadyDaemon{Watcher: Watcher{dd}, err: errors.New("no database")})
+	if closeHealth := dd.serveHealth(); closeHealth == nil || dd.health != nil {
+		t.Error("serveHealth() without Listen serves health checks")
+	}
+}
@@ -3,6 +3,8 @@ package daemons
 import (
 	"github.com/phantom-d/go-daemons/config"
 	"github.com/phantom-d/go-daemons/imports"
+
+	"fmt"
 	"os"
 	"syscall"
 )
@@ -17,9 +19,9 @@ func (imp *Import) SetData(data *DaemonData) {
 
 func (imp *Import) Run() (err error) {
 	for _, cfg := range imp.Workers {
-		if worker := imports.New(cfg, imp.Name, imp.Params); worker != nil {
+		for _, worker := range imports.NewReplicas(cfg, imp.Name, imp.Params) {
 			wd := worker.Data()
-			if config.Cfg().Worker == "" || config.Cfg().Worker == wd.Name {
+			if config.Cfg().Worker == wd.Name && config.Cfg().Replica == wd.Replica {
 				var dm *os.Process
 				dm, err = wd.Context.Search()
 				if err != nil {
@@ -31,19 +33,34 @@ func (imp *Import) Run() (err error) {
 					}
 				}
 				if dm == nil {
-					if config.Cfg().Worker == wd.Name {
-						if err = imports.Run(worker); err != nil {
-							config.Log().Error().Err(err).Msgf("Start worker '%s'", cfg.Name)
-							err = nil
-						}
-						break
-					} else {
-						if err = worker.Run(); err != nil {
-							config.Log().Error().Err(err).Msgf("Exec worker '%s'", cfg.Name)
-							err = nil
-						}
+					if err = imports.Run(worker); err != nil && !config.Cfg().Once {
+						config.Log().Error().Err(err).Msgf("Start worker '%s'", cfg.Name)
+						err = nil
 					}
+				} else if config.Cfg().Once {
+					err = fmt.Errorf("worker '%s' is already running", wd.Name)
+				}
+				return
+			} else if config.Cfg().Worker == "" {
+				name := wd.Context.Name
+				running, exit := imp.alive(name, wd.Context)
+				rs := imp.restartState(imp.Name + "_" + name)
+				if running && !wd.Context.Held() {
+					imp.checkMemory(name, wd.Context, rs, wd.MemoryLimit, wd.MemoryAction)
+				}
+				if running || wd.Context.Held() {
+					continue
+				}
+				if !imp.allowStart(rs.Name, wd.Context, wd.Restart, exit) {
+					continue
 				}
+				wd.Context.Exits, wd.Context.Stopped = imp.exits, imp.done
+				if err = worker.Run(); err != nil {
+					config.Log().Error().Err(err).Msgf("Exec worker '%s'", cfg.Name)
+					err = nil
+					continue
+				}
+				imp.spawned(name, wd.Context)
 			}
 		}
 	}
@@ -51,21 +68,19 @@ func (imp *Import) Run() (err error) {
 }
 
 func (imp *Import) Terminate(s os.Signal) {
+	var children []childProcess
+	var names []string
 	for _, cfg := range imp.Workers {
-		if worker := imports.New(cfg, imp.Name, imp.Params); worker != nil {
+		for _, worker := range imports.NewReplicas(cfg, imp.Name, imp.Params) {
 			wd := worker.Data()
-			dm, err := wd.Context.Search()
-			config.Log().Debug().Msgf("Terminate worker process: '%+v'", dm)
-			config.Log().Debug().Msgf("Terminate worker Context: '%+v'", wd.Context)
-			if err == nil {
-				if err := dm.Signal(s); err != nil {
-					config.Log().Error().Err(err).Msgf("Terminate worker '%s'", cfg.Name)
-				}
-			} else {
-				config.Log().Error().Err(err).Msgf("Terminate worker '%s'", cfg.Name)
+			if child, ok := imp.child(wd.Context.Name, wd.Context); ok {
+				children = append(children, child)
+				names = append(names, imp.Name+"_"+wd.Context.Name)
 			}
 		}
 	}
+	terminate(children, s, imp.ShutdownTimeout)
+	imp.stopped(names)
 	err := imp.Context.Release()
 	if err != nil {
 		config.Log().Error().Err(err).Msgf("Worker '%s' terminate", imp.Name)
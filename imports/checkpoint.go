@@ -0,0 +1,186 @@
+package imports
+
+import (
+	"github.com/phantom-d/go-daemons/config"
+
+	"time"
+)
+
+// A Checkpoint records progress of the worker: ids of the last batch
+// returned by ExtractId, which is completed with every batch fetched before.
+// Cursor is the last of them, Items is the number of items checkpointed since
+// the checkpoint was created.
+type Checkpoint struct {
+	Ids    []string  `json:"ids"`
+	Cursor string    `json:"cursor"`
+	Items  uint64    `json:"items"`
+	Time   time.Time `json:"time"`
+}
+
+// A CheckpointStore persists checkpoints of the worker replicas. Workers
+// implementing it store their checkpoints instead of the FileCheckpoints.
+type CheckpointStore interface {
+	// LoadCheckpoint returns the saved checkpoint of the worker, nil if
+	// there is none.
+	LoadCheckpoint(worker *Worker) (*Checkpoint, error)
+	SaveCheckpoint(worker *Worker, checkpoint Checkpoint) error
+}
+
+// A Resumer is implemented by workers which resume processing from the
+// checkpoint saved before restart. Resume is called before the first run,
+// GetEntities may also use LastCheckpoint of the worker.
+type Resumer interface {
+	Resume(checkpoint Checkpoint) error
+}
+
+// FileCheckpoints store checkpoints next to the pid files of the workers,
+// the files are replaced atomically.
+type FileCheckpoints struct{}
+
+func (FileCheckpoints) LoadCheckpoint(worker *Worker) (checkpoint *Checkpoint, err error) {
+	checkpoint = &Checkpoint{}
+	if ok, err := readFile(worker.Context.FileName(".checkpoint"), checkpoint); !ok {
+		return nil, err
+	}
+	return
+}
+
+func (FileCheckpoints) SaveCheckpoint(worker *Worker, checkpoint Checkpoint) error {
+	return writeFile(worker.Context.FileName(".checkpoint"), checkpoint)
+}
+
+// LastCheckpoint returns the last checkpoint of the worker, nil if there is
+// none.
+func (w *Worker) LastCheckpoint() *Checkpoint {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.checkpoint == nil {
+		return nil
+	}
+	checkpoint := *w.checkpoint
+	return &checkpoint
+}
+
+func checkpointStore(w ContextWorker) CheckpointStore {
+	if store, ok := Unwrap(w).(CheckpointStore); ok {
+		return store
+	}
+	return FileCheckpoints{}
+}
+
+// resume loads the checkpoint of the worker and passes it to the Resumer.
+func (w *Worker) resume(wi ContextWorker) {
+	checkpoint, err := checkpointStore(wi).LoadCheckpoint(w)
+	if err != nil {
+		config.Log().Error().Err(err).Msgf("Worker '%s' load checkpoint", w.Name)
+	}
+	if checkpoint == nil {
+		return
+	}
+	w.mu.Lock()
+	w.checkpoint = checkpoint
+	w.mu.Unlock()
+	config.Log().Info().Str("cursor", checkpoint.Cursor).Msgf("Worker '%s' resumes from checkpoint", w.Name)
+	if resumer, ok := Unwrap(wi).(Resumer); ok {
+		if err = resumer.Resume(*checkpoint); err != nil {
+			w.fail(nil, err, "Resume")
+		}
+	}
+}
+
+// A progress orders the completed batches for checkpoints. Batches are
+// numbered as fetched, the checkpoint advances only over batches completed
+// one after another, so a batch still processed concurrently is not skipped
+// after restart. A batch with failed items waiting for retry in memory holds
+// the checkpoint back until the items are processed, dead-lettered or saved
+// when the worker stops.
+type progress struct {
+	fetched int
+	next    int
+	done    map[int][]string
+	held    map[int]int
+}
+
+// fetch returns the number of the fetched batch.
+func (p *progress) fetch() (batch int) {
+	batch = p.fetched
+	p.fetched++
+	return
+}
+
+// complete records ids of the completed batch, nil if it has none.
+func (p *progress) complete(batch int, ids []string) {
+	if p.done == nil {
+		p.done = make(map[int][]string)
+	}
+	p.done[batch] = ids
+}
+
+func (p *progress) hold(batch int) {
+	if p.held == nil {
+		p.held = make(map[int]int)
+	}
+	p.held[batch]++
+}
+
+func (p *progress) release(batch int) {
+	if p.held[batch]--; p.held[batch] <= 0 {
+		delete(p.held, batch)
+	}
+}
+
+// advance passes the completed batches not held back. Returns ids of the
+// last passed batch having ids and the number of ids of all passed batches.
+func (p *progress) advance() (ids []string, items uint64) {
+	for {
+		batchIds, ok := p.done[p.next]
+		if !ok || p.held[p.next] > 0 {
+			return
+		}
+		delete(p.done, p.next)
+		p.next++
+		if len(batchIds) > 0 {
+			ids = batchIds
+			items += uint64(len(batchIds))
+		}
+	}
+}
+
+// saveCheckpoint records ids of the completed batch and saves the
+// checkpoint if it has advanced. Batches of retried items, failed by a hook
+// or without ids are passed without ids. Returns the error of ExtractId.
+func (w *Worker) saveCheckpoint(wi ContextWorker, j *job) (err error) {
+	var ids []string
+	if j.retry == nil && j.data != nil && len(j.errs) == 0 {
+		if ids, err = wi.ExtractId(j.data); err != nil {
+			ids = nil
+		}
+	}
+	if j.retry == nil {
+		w.mu.Lock()
+		w.progress.complete(j.origin, ids)
+		w.mu.Unlock()
+	}
+	w.advanceCheckpoint(wi)
+	return
+}
+
+// advanceCheckpoint saves the checkpoint if it has advanced.
+func (w *Worker) advanceCheckpoint(wi ContextWorker) {
+	w.mu.Lock()
+	ids, items := w.progress.advance()
+	if len(ids) == 0 {
+		w.mu.Unlock()
+		return
+	}
+	checkpoint := Checkpoint{Ids: ids, Cursor: ids[len(ids)-1], Time: time.Now()}
+	if w.checkpoint != nil {
+		checkpoint.Items = w.checkpoint.Items
+	}
+	checkpoint.Items += items
+	w.checkpoint = &checkpoint
+	w.mu.Unlock()
+	if err := checkpointStore(wi).SaveCheckpoint(w, checkpoint); err != nil {
+		config.Log().Error().Err(err).Msgf("Worker '%s' save checkpoint", w.Name)
+	}
+}
@@ -0,0 +1,82 @@
+package imports
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestProgressAdvance(t *testing.T) {
+	// hold and release are the numbers of holds of the first batch.
+	type step struct {
+		complete int
+		ids      []string
+		hold     int
+		release  int
+		want     []string
+		items    uint64
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "in order",
+			steps: []step{
+				{complete: 0, ids: []string{"1", "2"}, want: []string{"1", "2"}, items: 2},
+				{complete: 1, ids: []string{"3"}, want: []string{"3"}, items: 1},
+			},
+		},
+		{
+			name: "later batch completed first",
+			steps: []step{
+				{complete: 1, ids: []string{"3"}},
+				{complete: 2, ids: []string{"4"}},
+				{complete: 0, ids: []string{"1", "2"}, want: []string{"4"}, items: 4},
+			},
+		},
+		{
+			name: "batch without ids is passed",
+			steps: []step{
+				{complete: 1, ids: []string{"3"}},
+				{complete: 0, want: []string{"3"}, items: 1},
+			},
+		},
+		{
+			name: "held batch",
+			steps: []step{
+				{hold: 1, complete: 0, ids: []string{"1"}},
+				{complete: 1, ids: []string{"2"}},
+				{release: 1, complete: -1, want: []string{"2"}, items: 2},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var p progress
+			for i, s := range tt.steps {
+				for h := 0; h < s.hold; h++ {
+					p.hold(0)
+				}
+				for r := 0; r < s.release; r++ {
+					p.release(0)
+				}
+				if s.complete >= 0 {
+					p.complete(s.complete, s.ids)
+				}
+				ids, items := p.advance()
+				if !reflect.DeepEqual(ids, s.want) || items != s.items {
+					t.Errorf("step %d: advance() = %v, %d, want %v, %d", i, ids, items, s.want, s.items)
+				}
+			}
+		})
+	}
+}
+
+func TestProgressFetch(t *testing.T) {
+	var p progress
+	for want := 0; want < 3; want++ {
+		if got := p.fetch(); got != want {
+			t.Errorf("fetch() = %d, want %d", got, want)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package imports
+
+import (
+	"context"
+	"os"
+)
+
+// A ContextWorker is a worker whose hooks receive the context of the run.
+// The context is cancelled when the worker is stopped by SIGINT, SIGTERM or
+// SIGQUIT, reloaded by SIGHUP or has exceeded its memory limit, so the hooks
+// may stop the work in progress. BeforeProcessing receives a pointer to the
+// batch data, it may replace or reset the batch. Implementations may embed
+// ContextBase for the default hooks.
+type ContextWorker interface {
+	AfterProcessing(ctx context.Context, errorItems interface{}) error
+	AfterRun(ctx context.Context, result *ResultProcess) error
+	BeforeProcessing(ctx context.Context, data interface{}) error
+	BeforeRun(ctx context.Context) (interface{}, error)
+	Data() *Worker
+	ExtractId(interface{}) ([]string, error)
+	GetEntities(ctx context.Context) (interface{}, error)
+	GetStatus() (bool, error)
+	Processing(ctx context.Context, data interface{}, result *ResultProcess) error
+	Run() error
+	SetData(worker *Worker)
+	Terminate(os.Signal)
+}
+
+// ContextBase provides default hooks of a ContextWorker.
+type ContextBase struct {
+	Worker
+}
+
+func (w *ContextBase) BeforeRun(ctx context.Context) (result interface{}, err error) {
+	return
+}
+
+func (w *ContextBase) AfterRun(ctx context.Context, result *ResultProcess) (err error) {
+	return
+}
+
+func (w *ContextBase) BeforeProcessing(ctx context.Context, data interface{}) (err error) {
+	return
+}
+
+func (w *ContextBase) AfterProcessing(ctx context.Context, errorItems interface{}) (err error) {
+	return
+}
+
+// Adapt returns a ContextWorker calling hooks of the worker, the context is
+// passed only to ProcessingContext of a ContextProcessor. A ContextWorker
+// returned by CreateInstance is returned as it is.
+func Adapt(w WorkerInterface) ContextWorker {
+	switch w := w.(type) {
+	case nil:
+		return nil
+	case *legacyWorker:
+		return w.ContextWorker
+	}
+	return &adapter{WorkerInterface: w}
+}
+
+// legacy returns the WorkerInterface calling hooks of the ContextWorker with
+// the background context.
+func legacy(w ContextWorker) WorkerInterface {
+	switch w := w.(type) {
+	case nil:
+		return nil
+	case *adapter:
+		return w.WorkerInterface
+	}
+	return &legacyWorker{ContextWorker: w}
+}
+
+// Unwrap returns the worker adapted by Adapt, the pipeline of a
+// PipelineWorker or the worker itself, so it is checked for optional
+// interfaces like Reloader or ReadinessChecker.
+func Unwrap(w ContextWorker) interface{} {
+	if u, ok := w.(unwrapper); ok {
+		return u.unwrap()
+	}
+	return w
+}
+
+type unwrapper interface {
+	unwrap() interface{}
+}
+
+type adapter struct {
+	WorkerInterface
+}
+
+func (a *adapter) unwrap() interface{} {
+	return a.WorkerInterface
+}
+
+func (a *adapter) AfterProcessing(ctx context.Context, errorItems interface{}) error {
+	return a.WorkerInterface.AfterProcessing(errorItems)
+}
+
+func (a *adapter) AfterRun(ctx context.Context, result *ResultProcess) error {
+	return a.WorkerInterface.AfterRun(result)
+}
+
+func (a *adapter) BeforeProcessing(ctx context.Context, data interface{}) error {
+	return a.WorkerInterface.BeforeProcessing(data)
+}
+
+func (a *adapter) BeforeRun(ctx context.Context) (interface{}, error) {
+	return a.WorkerInterface.BeforeRun()
+}
+
+func (a *adapter) GetEntities(ctx context.Context) (interface{}, error) {
+	return a.WorkerInterface.GetEntities()
+}
+
+func (a *adapter) Processing(ctx context.Context, data interface{}, result *ResultProcess) error {
+	if processor, ok := a.WorkerInterface.(ContextProcessor); ok {
+		return processor.ProcessingContext(ctx, data, result)
+	}
+	return a.WorkerInterface.Processing(data, result)
+}
+
+type legacyWorker struct {
+	ContextWorker
+}
+
+func (l *legacyWorker) AfterProcessing(errorItems interface{}) error {
+	return l.ContextWorker.AfterProcessing(context.Background(), errorItems)
+}
+
+func (l *legacyWorker) AfterRun(result *ResultProcess) error {
+	return l.ContextWorker.AfterRun(context.Background(), result)
+}
+
+func (l *legacyWorker) BeforeProcessing(data interface{}) error {
+	return l.ContextWorker.BeforeProcessing(context.Background(), data)
+}
+
+func (l *legacyWorker) BeforeRun() (interface{}, error) {
+	return l.ContextWorker.BeforeRun(context.Background())
+}
+
+func (l *legacyWorker) GetEntities() (interface{}, error) {
+	return l.ContextWorker.GetEntities(context.Background())
+}
+
+func (l *legacyWorker) Processing(data interface{}, result *ResultProcess) error {
+	return l.ContextWorker.Processing(context.Background(), data, result)
+}
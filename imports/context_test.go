@@ -0,0 +1,70 @@
+package imports
+
+import (
+	"context"
+	"testing"
+)
+
+type testContextWorker struct {
+	ContextBase
+}
+
+func (w *testContextWorker) GetEntities(ctx context.Context) (interface{}, error) {
+	return nil, nil
+}
+
+func (w *testContextWorker) ExtractId(interface{}) ([]string, error) {
+	return nil, nil
+}
+
+func (w *testContextWorker) Processing(ctx context.Context, data interface{}, result *ResultProcess) error {
+	return nil
+}
+
+func (w *testContextWorker) SetData(worker *Worker) {
+	w.Worker = *worker
+}
+
+type testWorker struct {
+	Worker
+}
+
+func (w *testWorker) GetEntities() (interface{}, error) {
+	return nil, nil
+}
+
+func (w *testWorker) ExtractId(interface{}) ([]string, error) {
+	return nil, nil
+}
+
+func (w *testWorker) Processing(data interface{}, result *ResultProcess) error {
+	return nil
+}
+
+func (w *testWorker) SetData(worker *Worker) {
+	w.Worker = *worker
+}
+
+func TestFactoryContextInstance(t *testing.T) {
+	factory := make(FactoryStore)
+	worker := &testContextWorker{}
+	factory.RegisterContext("test", func() ContextWorker { return worker })
+	if instance := factory.CreateInstance("test"); instance == nil {
+		t.Fatal("CreateInstance() = nil")
+	} else if got := Adapt(instance); got != worker {
+		t.Errorf("Adapt(CreateInstance()) = %v, want the registered worker", got)
+	}
+	if got := factory.CreateContextInstance("test"); got != worker {
+		t.Errorf("CreateContextInstance() = %v, want the registered worker", got)
+	}
+	if got := factory.CreateContextInstance("unknown"); got != nil {
+		t.Errorf("CreateContextInstance() = %v, want nil", got)
+	}
+}
+
+func TestLegacyRoundTrip(t *testing.T) {
+	worker := &testWorker{}
+	if got := legacy(Adapt(worker)); got != WorkerInterface(worker) {
+		t.Errorf("legacy(Adapt()) = %v, want the adapted worker", got)
+	}
+}
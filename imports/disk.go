@@ -0,0 +1,526 @@
+package imports
+
+import (
+	"github.com/phantom-d/go-daemons/config"
+
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// DefaultSegmentSize is the size of a disk queue segment file after which
+// messages are appended to the next segment, if the queue URL has no
+// "segment" parameter.
+const DefaultSegmentSize = 16 << 20
+
+// diskHeaderSize is the size of the record header: the body length and its
+// CRC-32 checksum.
+const diskHeaderSize = 8
+
+// A DiskQueue is a durable queue backend kept in a directory: messages are
+// appended to segment files and synced to disk before Publish returns. It is
+// opened by "disk://<name>" URL in the "queues" directory of PidDir, or by
+// "disk:///<path>" in the given directory, so producers in other processes,
+// e.g. the "enqueue" command, and replicas of the worker share the queue.
+//
+// Consumers share the offset of the next message. Consumed messages are
+// pending until acknowledged, messages pending for a consumer process which
+// is not running are delivered again, so messages are delivered at least
+// once across restarts. A consumer is identified by its pid and start time,
+// so a process reusing the pid does not hold its messages. Segments of
+// acknowledged messages are removed. Corrupted or truncated records are
+// moved aside to "<segment>.bad" files and skipped.
+type DiskQueue struct {
+	mu          sync.Mutex
+	dir         string
+	segmentSize int64
+	lock        *os.File
+}
+
+// A diskPosition is the offset of a record in the segment file.
+type diskPosition struct {
+	Segment uint64 `json:"segment"`
+	Offset  int64  `json:"offset"`
+}
+
+func (p diskPosition) less(other diskPosition) bool {
+	return p.Segment < other.Segment || p.Segment == other.Segment && p.Offset < other.Offset
+}
+
+// diskState is the state of the queue: Head is the offset of the next
+// message to consume, Tail is the end of the synced records, Pending are ids
+// of consumed messages with pids of their consumers, 0 if released.
+// Consumers are start times of the consumer processes by their pids.
+type diskState struct {
+	Head      diskPosition   `json:"head"`
+	Tail      diskPosition   `json:"tail"`
+	Pending   map[string]int `json:"pending,omitempty"`
+	Consumers map[int]uint64 `json:"consumers,omitempty"`
+}
+
+// errCorruptedRecord is returned by readMessage for a record whose checksum
+// does not match or which is truncated.
+var errCorruptedRecord = errors.New("disk queue: corrupted record")
+
+// OpenDiskQueue opens the queue in given directory, the directory is created
+// if it does not exist.
+func OpenDiskQueue(dir string, segmentSize int64) (q *DiskQueue, err error) {
+	if segmentSize <= 0 {
+		segmentSize = DefaultSegmentSize
+	}
+	if err = os.MkdirAll(dir, 0750); err != nil {
+		return
+	}
+	q = &DiskQueue{dir: dir, segmentSize: segmentSize}
+	if q.lock, err = os.OpenFile(filepath.Join(dir, "lock"), os.O_RDWR|os.O_CREATE, config.FilePerm); err != nil {
+		return nil, err
+	}
+	return
+}
+
+func openDiskQueue(u *url.URL, worker *Worker) (Queue, error) {
+	dir := u.Path
+	if u.Host != `` {
+		dir = filepath.Join(config.Cfg().PidDir, "queues", u.Host+u.Path)
+	}
+	if dir == `` {
+		return nil, errors.New("disk queue: name is not set")
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	var segmentSize int64
+	if segment := u.Query().Get("segment"); segment != `` {
+		if segmentSize, err = strconv.ParseInt(segment, 10, 64); err != nil {
+			return nil, fmt.Errorf("disk queue: invalid segment size %q", segment)
+		}
+	}
+	return OpenDiskQueue(dir, segmentSize)
+}
+
+// locked calls fn with the state of the queue locked against other
+// processes, the state is saved if fn has changed it.
+func (q *DiskQueue) locked(fn func(state *diskState) (changed bool, err error)) (err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if err = syscall.Flock(int(q.lock.Fd()), syscall.LOCK_EX); err != nil {
+		return
+	}
+	defer func() {
+		_ = syscall.Flock(int(q.lock.Fd()), syscall.LOCK_UN)
+	}()
+	state := &diskState{Head: diskPosition{Segment: 1}, Tail: diskPosition{Segment: 1}}
+	if _, err = readFile(q.fileName("state"), state); err != nil {
+		return
+	}
+	if state.Pending == nil {
+		state.Pending = make(map[string]int)
+	}
+	if state.Consumers == nil {
+		state.Consumers = make(map[int]uint64)
+	}
+	var changed bool
+	if changed, err = fn(state); err != nil || !changed {
+		return
+	}
+	return q.saveState(state)
+}
+
+// saveState replaces the state file and syncs it to disk.
+func (q *DiskQueue) saveState(state *diskState) (err error) {
+	var data []byte
+	if data, err = json.Marshal(state); err != nil {
+		return
+	}
+	name := q.fileName("state")
+	var file *os.File
+	if file, err = os.OpenFile(name+".tmp", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, config.FilePerm); err != nil {
+		return
+	}
+	if _, err = file.Write(data); err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return
+	}
+	if err = os.Rename(name+".tmp", name); err != nil {
+		return
+	}
+	return q.syncDir()
+}
+
+func (q *DiskQueue) syncDir() error {
+	dir, err := os.Open(q.dir)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
+
+func (q *DiskQueue) fileName(name string) string {
+	return filepath.Join(q.dir, name)
+}
+
+func (q *DiskQueue) segmentName(segment uint64) string {
+	return q.fileName(fmt.Sprintf("%020d.seg", segment))
+}
+
+func (q *DiskQueue) Publish(ctx context.Context, bodies ...[]byte) error {
+	if len(bodies) == 0 {
+		return nil
+	}
+	return q.locked(func(state *diskState) (changed bool, err error) {
+		var file *os.File
+		defer func() {
+			if file != nil {
+				_ = file.Close()
+			}
+		}()
+		for _, body := range bodies {
+			if state.Tail.Offset >= q.segmentSize {
+				if file != nil {
+					if err = file.Sync(); err != nil {
+						return
+					}
+					_ = file.Close()
+					file = nil
+				}
+				state.Tail = diskPosition{Segment: state.Tail.Segment + 1}
+			}
+			if file == nil {
+				if file, err = q.openTail(state.Tail); err != nil {
+					return
+				}
+			}
+			record := make([]byte, diskHeaderSize+len(body))
+			binary.BigEndian.PutUint32(record, uint32(len(body)))
+			binary.BigEndian.PutUint32(record[4:], crc32.ChecksumIEEE(body))
+			copy(record[diskHeaderSize:], body)
+			if _, err = file.Write(record); err != nil {
+				return
+			}
+			state.Tail.Offset += int64(len(record))
+		}
+		if err = file.Sync(); err != nil {
+			return
+		}
+		return true, q.syncDir()
+	})
+}
+
+// openTail opens the segment for appending at the tail, a record torn by a
+// crash after the tail is truncated.
+func (q *DiskQueue) openTail(tail diskPosition) (file *os.File, err error) {
+	if file, err = os.OpenFile(q.segmentName(tail.Segment), os.O_WRONLY|os.O_CREATE, config.FilePerm); err != nil {
+		return
+	}
+	if err = file.Truncate(tail.Offset); err == nil {
+		_, err = file.Seek(tail.Offset, io.SeekStart)
+	}
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return
+}
+
+func (q *DiskQueue) Consume(ctx context.Context, limit int) (messages []Message, err error) {
+	pid := os.Getpid()
+	err = q.locked(func(state *diskState) (changed bool, err error) {
+		changed = state.register(pid)
+		// Messages released or pending for consumers which are not running
+		// are delivered first.
+		alive := map[int]bool{pid: true}
+		var ids []string
+		for id, owner := range state.Pending {
+			if _, ok := alive[owner]; !ok && owner != 0 {
+				alive[owner] = state.consumerAlive(owner)
+			}
+			if !alive[owner] {
+				ids = append(ids, id)
+			}
+		}
+		sort.Slice(ids, func(i, j int) bool {
+			a, _ := parsePosition(ids[i])
+			b, _ := parsePosition(ids[j])
+			return a.less(b)
+		})
+		for _, id := range ids {
+			if len(messages) >= limit {
+				break
+			}
+			var message Message
+			var end int64
+			if message, end, err = q.readMessage(id, -1); errors.Is(err, errCorruptedRecord) {
+				delete(state.Pending, id)
+				changed = true
+				if err = q.moveAside(id, end, err); err != nil {
+					return
+				}
+				continue
+			} else if err != nil {
+				return
+			}
+			messages = append(messages, message)
+			state.Pending[id] = pid
+			changed = true
+		}
+		for len(messages) < limit && state.Head.less(state.Tail) {
+			var info fs.FileInfo
+			if info, err = os.Stat(q.segmentName(state.Head.Segment)); err != nil {
+				return
+			}
+			if state.Head.Segment < state.Tail.Segment && state.Head.Offset >= info.Size() {
+				state.Head = diskPosition{Segment: state.Head.Segment + 1}
+				changed = true
+				continue
+			}
+			id := formatPosition(state.Head)
+			segmentEnd := info.Size()
+			if state.Head.Segment == state.Tail.Segment {
+				segmentEnd = state.Tail.Offset
+			}
+			var message Message
+			var end int64
+			message, end, err = q.readMessage(id, segmentEnd)
+			if errors.Is(err, errCorruptedRecord) {
+				err = q.moveAside(id, end, err)
+			} else if err == nil {
+				messages = append(messages, message)
+				state.Pending[id] = pid
+			}
+			if err != nil {
+				return
+			}
+			state.Head.Offset = end
+			changed = true
+		}
+		return
+	})
+	if err != nil {
+		messages = nil
+	}
+	return
+}
+
+// readMessage reads the record with given id from its segment, the record
+// must end before limit, the end of the segment if limit is negative. Returns
+// the offset of the next record. The error of a corrupted record wraps
+// errCorruptedRecord, the end of a truncated one is the limit.
+func (q *DiskQueue) readMessage(id string, limit int64) (message Message, end int64, err error) {
+	var position diskPosition
+	if position, err = parsePosition(id); err != nil {
+		return
+	}
+	var file *os.File
+	if file, err = os.Open(q.segmentName(position.Segment)); err != nil {
+		return
+	}
+	defer file.Close()
+	if limit < 0 {
+		var info fs.FileInfo
+		if info, err = file.Stat(); err != nil {
+			return
+		}
+		limit = info.Size()
+	}
+	header := make([]byte, diskHeaderSize)
+	end = position.Offset + diskHeaderSize
+	if end <= limit {
+		if _, err = file.ReadAt(header, position.Offset); err != nil {
+			return
+		}
+		end = position.Offset + diskHeaderSize + int64(binary.BigEndian.Uint32(header))
+	}
+	if end > limit {
+		return message, limit, fmt.Errorf("%w %s in '%s': truncated", errCorruptedRecord, id, q.dir)
+	}
+	body := make([]byte, end-position.Offset-diskHeaderSize)
+	if _, err = file.ReadAt(body, position.Offset+diskHeaderSize); err != nil {
+		return
+	}
+	if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(header[4:]) {
+		return message, end, fmt.Errorf("%w %s in '%s': checksum mismatch", errCorruptedRecord, id, q.dir)
+	}
+	return Message{ID: id, Body: body}, end, nil
+}
+
+// moveAside appends the bytes of the corrupted record up to end to the
+// "<segment>.bad" file of its segment, so the record is skipped but kept for
+// inspection.
+func (q *DiskQueue) moveAside(id string, end int64, cause error) (err error) {
+	var position diskPosition
+	if position, err = parsePosition(id); err != nil {
+		return
+	}
+	var segment *os.File
+	if segment, err = os.Open(q.segmentName(position.Segment)); err != nil {
+		return
+	}
+	defer segment.Close()
+	name := strings.TrimSuffix(q.segmentName(position.Segment), ".seg") + ".bad"
+	var bad *os.File
+	if bad, err = os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, config.FilePerm); err != nil {
+		return
+	}
+	_, err = io.Copy(bad, io.NewSectionReader(segment, position.Offset, end-position.Offset))
+	if err == nil {
+		err = bad.Sync()
+	}
+	if closeErr := bad.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		config.Log().Warn().Err(cause).Msgf("Disk queue record %s is moved to '%s'", id, name)
+	}
+	return
+}
+
+// Ack removes the messages from pending and removes segments of which all
+// messages are acknowledged.
+func (q *DiskQueue) Ack(ctx context.Context, messages []Message) error {
+	return q.locked(func(state *diskState) (changed bool, err error) {
+		for _, message := range messages {
+			if _, ok := state.Pending[message.ID]; ok {
+				delete(state.Pending, message.ID)
+				changed = true
+			}
+		}
+		if changed {
+			err = q.compact(state)
+		}
+		return
+	})
+}
+
+// compact removes segments before the first message not acknowledged.
+func (q *DiskQueue) compact(state *diskState) (err error) {
+	first := state.Head
+	for id := range state.Pending {
+		if position, err := parsePosition(id); err == nil && position.less(first) {
+			first = position
+		}
+	}
+	var names []string
+	if names, err = filepath.Glob(q.fileName("*.seg")); err != nil {
+		return
+	}
+	for _, name := range names {
+		segment, err := strconv.ParseUint(strings.TrimSuffix(filepath.Base(name), ".seg"), 10, 64)
+		if err != nil || segment >= first.Segment {
+			continue
+		}
+		if err = os.Remove(name); err != nil {
+			return err
+		}
+	}
+	return
+}
+
+func (q *DiskQueue) Nack(ctx context.Context, messages []Message) error {
+	return q.Requeue(ctx, messages)
+}
+
+// Requeue releases the pending messages, so they are consumed again.
+func (q *DiskQueue) Requeue(ctx context.Context, messages []Message) error {
+	return q.locked(func(state *diskState) (changed bool, err error) {
+		for _, message := range messages {
+			if _, ok := state.Pending[message.ID]; ok {
+				state.Pending[message.ID] = 0
+				changed = true
+			}
+		}
+		return
+	})
+}
+
+// Close keeps pending messages of the process, they are delivered again
+// when the process has exited.
+func (q *DiskQueue) Close() error {
+	return q.lock.Close()
+}
+
+func formatPosition(position diskPosition) string {
+	return fmt.Sprintf("%d:%d", position.Segment, position.Offset)
+}
+
+func parsePosition(id string) (position diskPosition, err error) {
+	if _, err = fmt.Sscanf(id, "%d:%d", &position.Segment, &position.Offset); err != nil {
+		err = fmt.Errorf("disk queue: invalid message id %q", id)
+	}
+	return
+}
+
+// processAlive reports whether the process with given pid is running.
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// register records the start time of the consumer process, if it is known.
+func (state *diskState) register(pid int) (changed bool) {
+	started, err := processStartTime(pid)
+	if err != nil || state.Consumers[pid] == started {
+		return
+	}
+	state.Consumers[pid] = started
+	// Consumers holding no messages are forgotten.
+	owners := map[int]bool{pid: true}
+	for _, owner := range state.Pending {
+		owners[owner] = true
+	}
+	for consumer := range state.Consumers {
+		if !owners[consumer] {
+			delete(state.Consumers, consumer)
+		}
+	}
+	return true
+}
+
+// consumerAlive reports whether the consumer process is running. A process
+// started at another time than the registered consumer has reused its pid.
+func (state *diskState) consumerAlive(pid int) bool {
+	if !processAlive(pid) {
+		return false
+	}
+	registered, ok := state.Consumers[pid]
+	if !ok {
+		return true
+	}
+	started, err := processStartTime(pid)
+	return err != nil || started == registered
+}
+
+// processStartTime returns the start time of the process in clock ticks
+// after the system boot, the 22nd field of /proc/<pid>/stat.
+func processStartTime(pid int) (started uint64, err error) {
+	var data []byte
+	if data, err = os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid)); err != nil {
+		return
+	}
+	// The command name in parentheses may contain spaces.
+	fields := strings.Fields(string(data[bytes.LastIndexByte(data, ')')+1:]))
+	if len(fields) < 20 {
+		return 0, fmt.Errorf("unexpected format of /proc/%d/stat", pid)
+	}
+	return strconv.ParseUint(fields[19], 10, 64)
+}
@@ -0,0 +1,308 @@
+package imports
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func messageBodies(messages []Message) (result []string) {
+	for _, message := range messages {
+		result = append(result, string(message.Body))
+	}
+	return
+}
+
+func TestDiskQueue(t *testing.T) {
+	// Every step consumes at most consume messages and then acknowledges
+	// ack of them and requeues the rest.
+	type step struct {
+		consume int
+		ack     int
+		want    []string
+	}
+	tests := []struct {
+		name     string
+		segment  int64
+		publish  []string
+		steps    []step
+		segments int
+	}{
+		{
+			name:    "consumed in order",
+			publish: []string{"a", "b", "c"},
+			steps: []step{
+				{consume: 2, ack: 2, want: []string{"a", "b"}},
+				{consume: 2, ack: 1, want: []string{"c"}},
+			},
+			segments: 1,
+		},
+		{
+			name:    "requeued first",
+			publish: []string{"a", "b", "c"},
+			steps: []step{
+				{consume: 2, ack: 1, want: []string{"a", "b"}},
+				{consume: 2, ack: 2, want: []string{"b", "c"}},
+				{consume: 2, want: nil},
+			},
+			segments: 1,
+		},
+		{
+			name:    "acknowledged segments removed",
+			segment: 1,
+			publish: []string{"a", "b", "c"},
+			steps: []step{
+				{consume: 2, ack: 2, want: []string{"a", "b"}},
+			},
+			segments: 2,
+		},
+		{
+			name:    "segments kept for pending messages",
+			segment: 1,
+			publish: []string{"a", "b", "c"},
+			steps: []step{
+				{consume: 3, want: []string{"a", "b", "c"}},
+				{consume: 3, ack: 1, want: []string{"a", "b", "c"}},
+			},
+			segments: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			queue, err := OpenDiskQueue(dir, tt.segment)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer queue.Close()
+			ctx := context.Background()
+			for _, body := range tt.publish {
+				if err = queue.Publish(ctx, []byte(body)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for i, s := range tt.steps {
+				messages, err := queue.Consume(ctx, s.consume)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := messageBodies(messages); !reflect.DeepEqual(got, s.want) {
+					t.Fatalf("step %d: Consume() = %q, want %q", i, got, s.want)
+				}
+				if err = queue.Ack(ctx, messages[:s.ack]); err != nil {
+					t.Fatal(err)
+				}
+				if err = queue.Requeue(ctx, messages[s.ack:]); err != nil {
+					t.Fatal(err)
+				}
+			}
+			segments, _ := filepath.Glob(filepath.Join(dir, "*.seg"))
+			if len(segments) != tt.segments {
+				t.Errorf("segments = %d, want %d", len(segments), tt.segments)
+			}
+		})
+	}
+}
+
+func TestDiskQueueRedelivery(t *testing.T) {
+	dir := t.TempDir()
+	queue, err := OpenDiskQueue(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer queue.Close()
+	ctx := context.Background()
+	if err = queue.Publish(ctx, []byte("a"), []byte("b")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = queue.Consume(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+	if messages, _ := queue.Consume(ctx, 2); len(messages) != 0 {
+		t.Fatalf("Consume() = %q, want no messages pending for the running process", messageBodies(messages))
+	}
+	// The messages become pending for a process which has exited.
+	cmd := exec.Command("true")
+	if err = cmd.Run(); err != nil {
+		t.Skip(err)
+	}
+	err = queue.locked(func(state *diskState) (bool, error) {
+		for id := range state.Pending {
+			state.Pending[id] = cmd.Process.Pid
+		}
+		return true, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages, err := queue.Consume(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := messageBodies(messages), []string{"a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Consume() = %q, want %q", got, want)
+	}
+}
+
+func TestDiskQueueTornRecord(t *testing.T) {
+	dir := t.TempDir()
+	queue, err := OpenDiskQueue(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer queue.Close()
+	ctx := context.Background()
+	if err = queue.Publish(ctx, []byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	// A record torn by a crash is written after the synced tail.
+	segment, err := os.OpenFile(queue.segmentName(1), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = segment.Write([]byte{0, 0, 0, 9, 1, 2})
+	_ = segment.Close()
+	if err = queue.Publish(ctx, []byte("b")); err != nil {
+		t.Fatal(err)
+	}
+	messages, err := queue.Consume(ctx, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := messageBodies(messages), []string{"a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Consume() = %q, want %q", got, want)
+	}
+}
+
+func TestDiskQueueCorruptedRecord(t *testing.T) {
+	corrupt := func(t *testing.T, name string) {
+		segment, err := os.OpenFile(name, os.O_WRONLY, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = segment.WriteAt([]byte("x"), diskHeaderSize+1)
+		_ = segment.Close()
+	}
+	truncate := func(size int64) func(t *testing.T, name string) {
+		return func(t *testing.T, name string) {
+			if err := os.Truncate(name, size); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	tests := []struct {
+		name   string
+		damage func(t *testing.T, name string)
+		// released damages the record consumed and requeued before.
+		released bool
+		bad      int64
+	}{
+		{name: "checksum mismatch", damage: corrupt, bad: diskHeaderSize + 3},
+		{name: "truncated header", damage: truncate(5), bad: 5},
+		{name: "truncated body", damage: truncate(diskHeaderSize + 1), bad: diskHeaderSize + 1},
+		{name: "released record", damage: corrupt, released: true, bad: diskHeaderSize + 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Every record is written to its own segment.
+			queue, err := OpenDiskQueue(t.TempDir(), 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer queue.Close()
+			ctx := context.Background()
+			if err = queue.Publish(ctx, []byte("abc"), []byte("def")); err != nil {
+				t.Fatal(err)
+			}
+			if tt.released {
+				messages, err := queue.Consume(ctx, 1)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err = queue.Requeue(ctx, messages); err != nil {
+					t.Fatal(err)
+				}
+			}
+			tt.damage(t, queue.segmentName(1))
+			messages, err := queue.Consume(ctx, 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := messageBodies(messages), []string{"def"}; !reflect.DeepEqual(got, want) {
+				t.Errorf("Consume() = %q, want %q", got, want)
+			}
+			info, err := os.Stat(queue.fileName(fmt.Sprintf("%020d.bad", 1)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Size() != tt.bad {
+				t.Errorf("bad file size = %d, want %d", info.Size(), tt.bad)
+			}
+			err = queue.locked(func(state *diskState) (bool, error) {
+				if len(state.Pending) != 1 {
+					t.Errorf("pending = %v, want the consumed record only", state.Pending)
+				}
+				return false, nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestDiskQueueReusedPid(t *testing.T) {
+	// The parent process is running, its start time is changed to pretend
+	// the pid is reused.
+	owner := os.Getppid()
+	started, err := processStartTime(owner)
+	if err != nil {
+		t.Skip(err)
+	}
+	tests := []struct {
+		name       string
+		registered map[int]uint64
+		redelivery bool
+	}{
+		{name: "running consumer", registered: map[int]uint64{owner: started}},
+		{name: "reused pid", registered: map[int]uint64{owner: started + 1}, redelivery: true},
+		{name: "unregistered consumer"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			queue, err := OpenDiskQueue(t.TempDir(), 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer queue.Close()
+			ctx := context.Background()
+			if err = queue.Publish(ctx, []byte("a")); err != nil {
+				t.Fatal(err)
+			}
+			if _, err = queue.Consume(ctx, 1); err != nil {
+				t.Fatal(err)
+			}
+			err = queue.locked(func(state *diskState) (bool, error) {
+				for id := range state.Pending {
+					state.Pending[id] = owner
+				}
+				state.Consumers = tt.registered
+				return true, nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			messages, err := queue.Consume(ctx, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if redelivery := len(messages) == 1; redelivery != tt.redelivery {
+				t.Errorf("Consume() = %q, redelivery %v, want %v", messageBodies(messages), redelivery, tt.redelivery)
+			}
+		})
+	}
+}
@@ -3,25 +3,57 @@ package imports
 import (
 	"context"
 	"os"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/phantom-d/go-daemons/config"
 )
 
 type Worker struct {
-	Name        string        `mapstructure:"Name"`
-	MemoryLimit uint64        `mapstructure:"MemoryLimit"`
-	Queue       string        `mapstructure:"Queue"`
-	Enabled     bool          `mapstructure:"Enabled"`
-	Sleep       time.Duration `mapstructure:"Sleep"`
-	Params      map[string]interface{}
-	Parent      string
-	Context     *config.Context
-	ctx         context.Context
-	signalChan  chan os.Signal
-	done        chan struct{}
+	Name            string               `mapstructure:"Name"`
+	MemoryLimit     uint64               `mapstructure:"MemoryLimit"`
+	MemoryAction    string               `mapstructure:"MemoryAction"`
+	MemoryCgroup    bool                 `mapstructure:"MemoryCgroup"`
+	Resources       config.Resources     `mapstructure:"Resources"`
+	Queue           string               `mapstructure:"Queue"`
+	Enabled         bool                 `mapstructure:"Enabled"`
+	Sleep           time.Duration        `mapstructure:"Sleep"`
+	ShutdownTimeout time.Duration        `mapstructure:"ShutdownTimeout"`
+	Health          config.HealthCheck   `mapstructure:"Health"`
+	Concurrency     int                  `mapstructure:"Concurrency"`
+	Replicas        int                  `mapstructure:"Replicas"`
+	Buffer          int                  `mapstructure:"Buffer"`
+	Ordered         bool                 `mapstructure:"Ordered"`
+	BatchTimeout    time.Duration        `mapstructure:"BatchTimeout"`
+	Schedule        string               `mapstructure:"Schedule"`
+	Timezone        string               `mapstructure:"Timezone"`
+	Overlap         string               `mapstructure:"Overlap"`
+	Retry           config.RetryPolicy   `mapstructure:"Retry"`
+	Restart         config.RestartPolicy `mapstructure:"Restart"`
+	Params          map[string]interface{}
+	Replica         int
+	Parent          string
+	Context         *config.Context
+	ctx             context.Context
+	runCtx          context.Context
+	runCancel       context.CancelFunc
+	signalChan      chan os.Signal
+	mu              *sync.Mutex
+	lastError       error
+	metrics         Metrics
+	retries         []*retry
+	retryOnly       bool
+	checkpoint      *Checkpoint
+	progress        progress
+	queue           Queue
+	health          *config.Health
+	done            chan struct{}
 }
 
+// memoryCheckInterval is the period of memory limit checks during a run.
+const memoryCheckInterval = time.Second
+
 type WorkerInterface interface {
 	AfterProcessing(interface{}) error
 	AfterRun(*ResultProcess) error
@@ -37,12 +69,30 @@ type WorkerInterface interface {
 	Terminate(os.Signal)
 }
 
+// Reloader is implemented by workers which apply changed parameters without
+// restart. Reload is called on SIGHUP with the previous worker settings
+// after the new ones are set.
+type Reloader interface {
+	Reload(previous Worker) error
+}
+
+// ReadinessChecker is implemented by workers which check their dependencies
+// before a run. The run is skipped while the worker is not ready, the result
+// is reported by the readiness endpoint of the worker.
+type ReadinessChecker interface {
+	Ready() error
+}
+
 type ResultProcess struct {
-	Queue      string
-	Duration   time.Duration
-	Total      int
-	Memory     uint64
-	ErrorItems []interface{}
+	Queue      string        `json:"queue"`
+	Duration   time.Duration `json:"duration"`
+	Total      int           `json:"total"`
+	Memory     uint64        `json:"memory"`
+	ErrorItems []interface{} `json:"error_items"`
+	// err is the last error of the run, redeliveries are messages returned
+	// to the queue after the run. Concurrent runs keep them apart.
+	err          error
+	redeliveries []redelivery
 }
 
 type FactoryStore map[string]func() WorkerInterface
@@ -53,9 +103,33 @@ func (factory *FactoryStore) Register(name string, factoryFunc func() WorkerInte
 	(*factory)[name] = factoryFunc
 }
 
+// RegisterContext registers the worker with hooks receiving the context of
+// the run. CreateInstance returns it wrapped into a WorkerInterface, which
+// is unwrapped by Adapt.
+func (factory *FactoryStore) RegisterContext(name string, factoryFunc func() ContextWorker) {
+	(*factory)[name] = func() WorkerInterface {
+		return legacy(factoryFunc())
+	}
+}
+
 func (factory *FactoryStore) CreateInstance(name string) (result WorkerInterface) {
 	if factoryFunc, ok := (*factory)[name]; ok {
 		result = factoryFunc()
 	}
 	return
 }
+
+// CreateContextInstance returns the registered worker as a ContextWorker,
+// see Adapt.
+func (factory *FactoryStore) CreateContextInstance(name string) ContextWorker {
+	return Adapt(factory.CreateInstance(name))
+}
+
+// Names returns names of registered workers in sorted order.
+func (factory *FactoryStore) Names() (names []string) {
+	for name := range *factory {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return
+}
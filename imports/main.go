@@ -6,27 +6,74 @@ import (
 	"github.com/mitchellh/mapstructure"
 
 	"context"
+	"encoding/json"
 	"fmt"
+	"net"
 	"os"
 	"os/signal"
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 )
 
+// ReplicaEnv is the environment variable holding index of the worker replica.
+const ReplicaEnv = "GO_DAEMONS_REPLICA"
+
+// New returns the worker replica with index given by the "--replica" flag.
 func New(cfg config.Worker, parent string, params map[string]interface{}) WorkerInterface {
+	return NewReplica(cfg, parent, params, config.Cfg().Replica)
+}
+
+// NewReplicas returns every configured replica of the worker.
+func NewReplicas(cfg config.Worker, parent string, params map[string]interface{}) (workers []WorkerInterface) {
+	for replica := 0; replica < ReplicaCount(cfg); replica++ {
+		if w := NewReplica(cfg, parent, params, replica); w != nil {
+			workers = append(workers, w)
+		}
+	}
+	return
+}
+
+// ReplicaCount returns the number of replicas of the worker.
+func ReplicaCount(cfg config.Worker) int {
+	if cfg.Replicas < 1 {
+		return 1
+	}
+	return cfg.Replicas
+}
+
+// ReplicaName returns name of the worker replica used for its pid file and
+// status: the worker name for the first replica, "<name>_<replica>" for
+// others. The first replica keeps its name, so its process and files, like
+// the checkpoint, are kept when the worker is scaled.
+func ReplicaName(cfg config.Worker, replica int) string {
+	if replica == 0 {
+		return cfg.Name
+	}
+	return fmt.Sprintf("%s_%d", cfg.Name, replica)
+}
+
+// NewReplica returns the worker replica with given index. Replicas have own
+// pid files, get the index in the ReplicaEnv environment variable and serve
+// health checks on the configured port increased by the index.
+func NewReplica(cfg config.Worker, parent string, params map[string]interface{}, replica int) WorkerInterface {
 	var w WorkerInterface
 	if w = Factory.CreateInstance(cfg.Name); w != nil {
 		if cfg.Enabled {
-			wd := &Worker{Params: params, Parent: parent}
+			wd := &Worker{Params: params, Parent: parent, Replica: replica, mu: &sync.Mutex{}}
 			err := mapstructure.Decode(cfg, &wd)
 			if err != nil {
 				config.Log().Info().Msg("Worker load config")
 				return nil
 			}
-			pidFileName, err := filepath.Abs(fmt.Sprintf("%s/%s_%s.pid", config.Cfg().PidDir, parent, cfg.Name))
+			name := ReplicaName(cfg, replica)
+			pidFileName, err := filepath.Abs(fmt.Sprintf("%s/%s_%s.pid", config.Cfg().PidDir, parent, name))
 			if err != nil {
 				config.Log().Fatal().Err(err).Msgf("Init daemon '%s'", cfg.Name)
 			}
@@ -47,18 +94,37 @@ func New(cfg config.Worker, parent string, params map[string]interface{}) Worker
 			if notExists {
 				args = append(args, daemonArg)
 			}
-			args = append(args, "--worker="+cfg.Name)
+			args = append(args, "--worker="+cfg.Name, fmt.Sprintf("--replica=%d", replica))
+			if wd.Health.Listen != `` && replica > 0 {
+				if wd.Health.Listen, err = offsetPort(wd.Health.Listen, replica); err != nil {
+					config.Log().Error().Err(err).Msgf("Worker '%s' health endpoint", name)
+					wd.Health.Listen = ``
+				}
+			}
+			if wd.ShutdownTimeout <= 0 {
+				wd.ShutdownTimeout = config.DefaultShutdownTimeout
+			}
+			if wd.MemoryAction == `` {
+				wd.MemoryAction = config.MemorySkip
+			}
 			wd.Context = &config.Context{
-				Name:        cfg.Name,
+				Name:        name,
 				Type:        `worker`,
+				Parent:      parent,
 				PidFileName: pidFileName,
 				PidFilePerm: 0644,
 				WorkDir:     "./",
+				Env:         append(os.Environ(), fmt.Sprintf("%s=%d", ReplicaEnv, replica)),
 				Args:        args,
 			}
+			wd.Context.Resources = wd.Resources
+			if wd.MemoryCgroup && wd.Resources.MemoryMax == 0 {
+				wd.Context.Resources.MemoryMax = wd.MemoryLimit
+			}
 			w.SetData(wd)
 		} else {
 			config.Log().Info().Msgf("Worker '%s' is disabled!", cfg.Name)
+			w = nil
 		}
 	} else {
 		config.Log().Info().Msgf("Worker '%s' is not found!", cfg.Name)
@@ -66,20 +132,57 @@ func New(cfg config.Worker, parent string, params map[string]interface{}) Worker
 	return w
 }
 
-func Run(w WorkerInterface) (err error) {
+func offsetPort(address string, offset int) (string, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return ``, err
+	}
+	var number int
+	if number, err = strconv.Atoi(port); err != nil || number == 0 {
+		return ``, fmt.Errorf("invalid port in address %q", address)
+	}
+	return net.JoinHostPort(host, strconv.Itoa(number+offset)), nil
+}
+
+// Run runs the worker processing loop, see RunContext.
+func Run(w WorkerInterface) error {
+	return RunContext(Adapt(w))
+}
+
+// RunContext runs the worker processing loop. On SIGINT, SIGTERM or SIGQUIT
+// the worker stops taking new entities, lets the current batch finish
+// within ShutdownTimeout and returns nil. If the batch is not finished in
+// time or a second signal is received, the process exits with status 1.
+// Health checks are served if configured, runs are skipped while
+// a ReadinessChecker reports an error. The log is written to the worker
+// log file if LogFile is configured, the file is reopened on SIGUSR1. With
+// --once the worker runs once and returns ExitError describing the result,
+// see once.
+func RunContext(w ContextWorker) (err error) {
 	var cancel context.CancelFunc
 	wd := w.Data()
+	if err = config.OpenLog(wd.Parent, wd.Context.Name); err != nil {
+		return
+	}
+	timer, err := config.NewTimer(wd.Schedule, wd.Timezone, wd.Sleep)
+	if err != nil {
+		return
+	}
 	err = wd.Context.CreatePidFile()
 	if err != nil {
 		config.Log().Fatal().Err(err).Msgf("Worker '%s' Process", wd.Name)
 	}
 	wd.ctx, cancel = context.WithCancel(context.Background())
 	wd.signalChan = make(chan os.Signal, 1)
-	signal.Notify(wd.signalChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+	wd.done = make(chan struct{})
+	stopped := make(chan os.Signal, 1)
+	reloads := make(chan struct{}, 1)
+	signal.Notify(wd.signalChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT, syscall.SIGHUP)
 
 	defer func() {
 		signal.Stop(wd.signalChan)
 		cancel()
+		close(wd.done)
 	}()
 
 	go func() {
@@ -88,81 +191,445 @@ func Run(w WorkerInterface) (err error) {
 			case s := <-wd.signalChan:
 				switch s {
 				case syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT:
+					if wd.ctx.Err() != nil {
+						config.Log().Warn().Msgf("worker '%s' forced to exit", wd.Name)
+						wd.exit()
+					}
 					config.Log().Info().Msgf("worker '%s' terminate", wd.Name)
+					stopped <- s
 					cancel()
-					w.Terminate(s)
-					err := wd.Context.Release()
-					if err != nil {
-						config.Log().Error().Err(err).Msgf("Worker '%s' terminate", wd.Name)
+					go func() {
+						select {
+						case <-wd.done:
+						case <-time.After(wd.ShutdownTimeout):
+							config.Log().Warn().Msgf("worker '%s' is not done in %s", wd.Name, wd.ShutdownTimeout)
+							wd.exit()
+						}
+					}()
+				case syscall.SIGHUP:
+					if !config.Cfg().Once {
+						wd.interrupt("reload")
+					}
+					select {
+					case reloads <- struct{}{}:
+					default:
 					}
-					os.Exit(1)
 				}
-			case <-wd.ctx.Done():
-				config.Log().Info().Msgf("worker '%s' is done", wd.Name)
-				os.Exit(1)
+			case <-wd.done:
+				return
 			}
 		}
 	}()
 
+	wd.resume(w)
+	wd.loadRetries()
+	if config.Cfg().Once {
+		return once(w)
+	}
+	if wd.Health.Listen != `` {
+		wd.health = config.NewHealth(wd.Name, wd.Health, wd.Sleep)
+		var closeHealth func()
+		if closeHealth, err = wd.health.Serve(wd.Health.Listen); err != nil {
+			config.Log().Error().Err(err).Msgf("Worker '%s' health endpoint", wd.Name)
+			wd.health, err = nil, nil
+		} else {
+			defer closeHealth()
+		}
+	}
+	wd.heartbeat(w)
+	var (
+		keepalive <-chan time.Time
+		runs      sync.WaitGroup
+	)
+	if wd.health != nil {
+		keepalive = time.Tick(wd.health.Interval())
+	}
+	next := timer.C()
+
 	config.Log().Info().Msgf("Start worker '%s'!", wd.Name)
 	for {
 		select {
 		case <-wd.ctx.Done():
+			if wd.health != nil {
+				wd.health.Stopping()
+			}
+			runs.Wait()
+			wd.saveRetries(w)
+			wd.closeQueue()
+			w.Terminate(config.StopSignal(stopped))
+			if err = wd.Context.Release(); err != nil {
+				config.Log().Error().Err(err).Msgf("Worker '%s' terminate", wd.Name)
+			}
+			config.Log().Info().Msgf("worker '%s' is done", wd.Name)
 			return
-		case <-time.Tick(wd.Sleep):
-			var result ResultProcess
-			runtime.GC()
-			memStats := &runtime.MemStats{}
-			runtime.ReadMemStats(memStats)
-			_, err = w.BeforeRun()
-			if err != nil {
-				config.Log().Error().Err(err).Msgf("Worker '%s' processing BeforeRun", wd.Name)
+		case <-reloads:
+			// Overlapping runs use the settings changed by the reload.
+			runs.Wait()
+			reload(w)
+			if reloaded, err := config.NewTimer(wd.Schedule, wd.Timezone, wd.Sleep); err != nil {
+				config.Log().Error().Err(err).Msgf("Reload worker '%s' schedule", wd.Name)
+			} else {
+				timer = reloaded
 			}
-			if memStats.Alloc > wd.MemoryLimit {
+			next = timer.C()
+		case <-keepalive:
+			wd.health.Tick()
+		case tick := <-next:
+			if wd.ctx.Err() != nil {
 				break
 			}
-			timeStart := time.Now()
-			data, errorData := w.GetEntities()
-			runtime.ReadMemStats(memStats)
-			for errorData == nil && data != nil {
-				result := ResultProcess{Queue: wd.Queue}
-				if memStats.Alloc > wd.MemoryLimit {
-					break
-				}
-				err := w.BeforeProcessing(&data)
-				if err != nil {
-					config.Log().Error().Err(err).Msgf("Worker '%s' processing BeforeProcessing", wd.Name)
-				}
-				if data != nil {
-					err = w.Processing(data, &result)
-					if err != nil {
-						config.Log().Error().Err(err).Msgf("Worker '%s' processing", wd.Name)
-					}
-				}
-				err = w.AfterProcessing(result.ErrorItems)
-				if err != nil {
-					config.Log().Error().Err(err).Msgf("Worker '%s' processing AfterProcessing", wd.Name)
+			if timer.Scheduled() && wd.Overlap == config.OverlapAllow {
+				next = timer.C()
+				runs.Add(1)
+				go func() {
+					defer runs.Done()
+					wd.run(w, tick)
+				}()
+				break
+			}
+			wd.run(w, tick)
+			// Runs due while the run was in progress are skipped, or
+			// started once more with the queue overlap policy.
+			for wd.Overlap == config.OverlapQueue && wd.ctx.Err() == nil && timer.Missed(tick, time.Now()) {
+				for timer.Missed(tick, time.Now()) {
+					tick = timer.Next(tick)
 				}
-				timeStart = time.Now()
-				runtime.GC()
-				runtime.ReadMemStats(memStats)
-				data, errorData = w.GetEntities()
+				wd.run(w, tick)
 			}
+			next = timer.C()
+		}
+	}
+}
+
+// run processes entities once, tick is the time the run was due. The summary
+// of the run and the metrics of the worker are saved. Returns nil if the run
+// was skipped.
+func (w *Worker) run(wi ContextWorker, tick time.Time) (result *ResultProcess) {
+	lag := time.Since(tick)
+	if w.heartbeat(wi) {
+		if result = process(wi); result != nil {
+			w.redeliver(result)
+		}
+	}
+	runErr := w.runError(result)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if summary := result; summary != nil || runErr != nil {
+		if summary == nil {
+			summary = &ResultProcess{Queue: w.Queue}
+		}
+		if err := w.saveSummary(summary, runErr); err != nil {
+			config.Log().Error().Err(err).Msgf("Worker '%s' save summary", w.Name)
+		}
+	}
+	w.observe(result, lag)
+	if err := w.saveMetrics(); err != nil {
+		config.Log().Error().Err(err).Msgf("Worker '%s' save metrics", w.Name)
+	}
+	return
+}
 
-			if errorData != nil || data == nil {
-				result := ResultProcess{Queue: wd.Queue}
-				result.Duration = time.Now().Sub(timeStart)
-				runtime.ReadMemStats(memStats)
-				result.Memory = memStats.Alloc
+// runError returns the last error of the run, or the reason it was skipped
+// if result is nil.
+func (w *Worker) runError(result *ResultProcess) error {
+	if result != nil {
+		return result.err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.lastError
+}
+
+// A OnceResult is printed by the worker run once. Kind is
+// config.OnceResultKind, so the supervisor prints it to its stdout instead
+// of the log.
+type OnceResult struct {
+	Kind        string `json:"kind"`
+	Worker      string `json:"worker"`
+	Code        int    `json:"code"`
+	Error       string `json:"error,omitempty"`
+	DeadLetters uint64 `json:"dead_letters,omitempty"`
+	*ResultProcess
+}
+
+// once processes entities until GetEntities returns no data, calls AfterRun
+// and prints the result as a JSON line. Failed items are retried by further
+// runs, not fetching new entities, until they succeed or are dead-lettered.
+// Returns ExitError with ExitPartial if there are error items, or dead
+// letters when retries are enabled, or with ExitFailure if the run was
+// skipped, interrupted or a hook has failed.
+func once(w ContextWorker) error {
+	wd := w.Data()
+	output := OnceResult{Kind: config.OnceResultKind, Worker: wd.Context.Name, ResultProcess: wd.run(w, time.Now())}
+	runErr := wd.runError(output.ResultProcess)
+	wd.retryOnly = true
+	for output.ResultProcess != nil && runErr == nil {
+		due, ok := wd.nextRetry()
+		if !ok {
+			break
+		}
+		select {
+		case <-wd.ctx.Done():
+		case <-time.After(time.Until(due)):
+		}
+		if wd.ctx.Err() != nil {
+			break
+		}
+		result := wd.run(w, due)
+		runErr = wd.runError(result)
+		if result != nil {
+			output.Total += result.Total
+			output.Duration += result.Duration
+			output.Memory = result.Memory
+			output.ErrorItems = append(output.ErrorItems, result.ErrorItems...)
+		}
+	}
+	wd.saveRetries(w)
+	wd.closeQueue()
+	output.DeadLetters = wd.metrics.DeadLetters
+	failed := len(output.ErrorItems) > 0
+	if wd.Retry.Enabled() {
+		failed = output.DeadLetters > 0
+	}
+	switch {
+	case runErr != nil:
+		output.Code, output.Error = config.ExitFailure, runErr.Error()
+	case output.ResultProcess == nil:
+		output.Code, output.Error = config.ExitFailure, "run is skipped"
+	case wd.ctx.Err() != nil:
+		output.Code, output.Error = config.ExitFailure, "run is interrupted"
+	case failed:
+		output.Code = config.ExitPartial
+	}
+	if output.ResultProcess == nil {
+		output.ResultProcess = &ResultProcess{Queue: wd.Queue}
+	}
+	printed := *output.ResultProcess
+	printed.Queue = redactQueue(printed.Queue)
+	output.ResultProcess = &printed
+	if err := json.NewEncoder(os.Stdout).Encode(output); err != nil {
+		config.Log().Error().Err(err).Msgf("Worker '%s' print result", wd.Name)
+	}
+	if err := wd.Context.Release(); err != nil {
+		config.Log().Error().Err(err).Msgf("Worker '%s' terminate", wd.Name)
+	}
+	config.Log().Info().Int("code", output.Code).Msgf("worker '%s' is done", wd.Name)
+	return config.NewExitError(output.Code)
+}
+
+// process runs an iteration of the worker: fetches and processes entities
+// while there are any and calls AfterRun with the accumulated result.
+// Returns nil if the iteration was skipped due to the memory limit.
+func process(w ContextWorker) (result *ResultProcess) {
+	wd := w.Data()
+	ctx := wd.runContext()
+	if wd.MemoryLimit > 0 {
+		stop := make(chan struct{})
+		defer close(stop)
+		go wd.watchMemory(stop)
+	}
+	runtime.GC()
+	result = &ResultProcess{Queue: wd.Queue}
+	_, err := w.BeforeRun(ctx)
+	if err != nil {
+		wd.fail(result, err, "BeforeRun")
+	}
+	if wd.overMemory(nil) {
+		return nil
+	}
+	timeStart := time.Now()
+	var errorData error
+	if wd.Concurrency > 1 {
+		errorData = processPool(ctx, w, result)
+	} else {
+		errorData = processSerial(ctx, w, result)
+	}
+	if errorData != nil {
+		wd.fail(result, errorData, "GetEntities")
+	}
+	result.Duration = time.Since(timeStart)
+	memStats := &runtime.MemStats{}
+	runtime.ReadMemStats(memStats)
+	result.Memory = memStats.Alloc
+	err = w.AfterRun(ctx, result)
+	if err != nil {
+		wd.fail(result, err, "AfterRun")
+	}
+	return
+}
+
+// runContext returns the context of the runs, it is shared by concurrent
+// runs until cancelled by interrupt or shutdown of the worker.
+func (w *Worker) runContext() context.Context {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.runCtx == nil || w.runCtx.Err() != nil {
+		w.runCtx, w.runCancel = context.WithCancel(w.ctx)
+	}
+	return w.runCtx
+}
+
+// interrupt cancels the context of the runs in progress.
+func (w *Worker) interrupt(reason string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.runCancel != nil && w.runCtx.Err() == nil {
+		config.Log().Info().Msgf("Worker '%s' run is cancelled: %s", w.Name, reason)
+		w.runCancel()
+	}
+}
+
+// watchMemory interrupts the run when the worker exceeds its memory limit,
+// the limit is checked every memoryCheckInterval until stop is closed.
+func (w *Worker) watchMemory(stop <-chan struct{}) {
+	ticker := time.NewTicker(memoryCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if w.overMemory(nil) {
+				w.interrupt("memory limit exceeded")
+				return
 			}
-			runtime.GC()
-			runtime.ReadMemStats(memStats)
-			err = w.AfterRun(&result)
-			if err != nil {
-				config.Log().Error().Err(err).Msgf("Worker '%s' processing AfterRun", wd.Name)
+		}
+	}
+}
+
+// overMemory reports whether resident memory of the worker process exceeds
+// MemoryLimit, zero limit means no limit. The breach is logged and kept as
+// the error of the run, or as the reason the run is skipped if result is
+// nil. The worker skips processing while it is over the limit and the import
+// daemon restarts or kills it according to MemoryAction.
+func (w *Worker) overMemory(result *ResultProcess) bool {
+	if w.MemoryLimit == 0 {
+		return false
+	}
+	rss, err := config.ProcessMemory(os.Getpid())
+	if err == nil && rss > w.MemoryLimit {
+		debug.FreeOSMemory()
+		rss, err = config.ProcessMemory(os.Getpid())
+	}
+	if err != nil {
+		config.Log().Error().Err(err).Msgf("Worker '%s' memory usage", w.Name)
+		return false
+	}
+	if rss <= w.MemoryLimit {
+		return false
+	}
+	err = fmt.Errorf("memory limit exceeded: rss %d > %d", rss, w.MemoryLimit)
+	w.mu.Lock()
+	if result != nil {
+		result.err = err
+	} else {
+		w.lastError = err
+	}
+	w.metrics.MemoryBreaches += 1
+	w.mu.Unlock()
+	config.Log().Warn().
+		Uint64("rss", rss).
+		Uint64("limit", w.MemoryLimit).
+		Str("action", w.MemoryAction).
+		Msgf("Worker '%s' memory limit exceeded", w.Name)
+	return true
+}
+
+// fail logs an error of the worker hook and keeps it as the error of the
+// run, result is nil if the hook is called out of a run.
+func (w *Worker) fail(result *ResultProcess, err error, hook string) {
+	w.mu.Lock()
+	if result != nil {
+		result.err = err
+	}
+	w.metrics.Errors += 1
+	w.mu.Unlock()
+	config.Log().Error().Err(err).Msg(strings.TrimSpace(fmt.Sprintf("Worker '%s' processing %s", w.Name, hook)))
+}
+
+// reload re-reads configuration files and applies changed settings of the
+// worker. Workers implementing Reloader are notified about the change.
+// Changes of config.RestartFields are not applied, they are logged as
+// requiring restart. It is called when no run is in progress.
+func reload(w ContextWorker) {
+	wd := w.Data()
+	if len(config.Cfg().ConfigFiles) == 0 {
+		config.Log().Warn().Msgf("Reload worker '%s': no configuration files", wd.Name)
+		return
+	}
+	if err := config.Configure(); err != nil {
+		config.Log().Error().Err(err).Msgf("Reload worker '%s'", wd.Name)
+		return
+	}
+	if err := config.OpenLog(wd.Parent, wd.Context.Name); err != nil {
+		config.Log().Error().Err(err).Msgf("Reload worker '%s' log file", wd.Name)
+	}
+	daemon := config.Cfg().Daemons[wd.Parent]
+	for _, cfg := range daemon.Workers {
+		if cfg.Name != wd.Name {
+			continue
+		}
+		previous := *wd
+		fresh := cfg
+		if fresh.Health.Listen != `` && wd.Replica > 0 {
+			fresh.Health.Listen, _ = offsetPort(fresh.Health.Listen, wd.Replica)
+		}
+		if restart := config.RestartChanges(wd, fresh); len(restart) > 0 {
+			config.Log().Warn().Strs("changes", restart).Msgf("Reload worker '%s': restart required", wd.Name)
+		}
+		wd.MemoryLimit = cfg.MemoryLimit
+		if cfg.MemoryAction != `` {
+			wd.MemoryAction = cfg.MemoryAction
+		}
+		wd.Queue = cfg.Queue
+		wd.Sleep = cfg.Sleep
+		wd.Schedule, wd.Timezone, wd.Overlap = cfg.Schedule, cfg.Timezone, cfg.Overlap
+		wd.Retry = cfg.Retry
+		wd.Concurrency, wd.Buffer, wd.Ordered, wd.BatchTimeout = cfg.Concurrency, cfg.Buffer, cfg.Ordered, cfg.BatchTimeout
+		if cfg.ShutdownTimeout > 0 {
+			wd.ShutdownTimeout = cfg.ShutdownTimeout
+		}
+		wd.Params = daemon.Params
+		if wd.Queue != previous.Queue {
+			wd.closeQueue()
+		}
+		config.Log().Info().Strs("changes", config.Diff(previous, *wd)).Msgf("Reload worker '%s'", wd.Name)
+		if reloader, ok := Unwrap(w).(Reloader); ok {
+			if err := reloader.Reload(previous); err != nil {
+				config.Log().Error().Err(err).Msgf("Reload worker '%s'", wd.Name)
 			}
 		}
+		return
+	}
+	config.Log().Warn().Msgf("Reload worker '%s': worker is not configured", wd.Name)
+}
+
+// heartbeat records a tick of the worker loop and checks readiness of the
+// worker. The check is called on every tick, also when health checks are
+// not served, so a worker not ready skips the run.
+func (w *Worker) heartbeat(wi ContextWorker) (ready bool) {
+	var err error
+	if checker, ok := Unwrap(wi).(ReadinessChecker); ok {
+		if err = checker.Ready(); err != nil {
+			w.mu.Lock()
+			w.lastError = err
+			w.mu.Unlock()
+			config.Log().Warn().Err(err).Msgf("Worker '%s' is not ready", w.Name)
+		}
+	}
+	if w.health != nil {
+		w.health.Tick()
+		w.health.SetReady(err)
+	}
+	return err == nil
+}
+
+// exit releases the pid file and terminates the process with status 1.
+func (w *Worker) exit() {
+	if err := w.Context.Release(); err != nil {
+		config.Log().Error().Err(err).Msgf("Worker '%s' terminate", w.Name)
 	}
+	os.Exit(1)
 }
 
 // Execute daemon as a new system process
@@ -0,0 +1,127 @@
+package imports
+
+import (
+	"github.com/phantom-d/go-daemons/config"
+
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// testReloadWorker runs longer than the schedule period and ignores the
+// cancellation of the run, so the runs overlap.
+type testReloadWorker struct {
+	testContextWorker
+	running  *int32
+	started  chan struct{}
+	reloaded chan error
+}
+
+func (w *testReloadWorker) GetEntities(ctx context.Context) (interface{}, error) {
+	atomic.AddInt32(w.running, 1)
+	defer atomic.AddInt32(w.running, -1)
+	select {
+	case w.started <- struct{}{}:
+	default:
+	}
+	time.Sleep(300 * time.Millisecond)
+	return nil, nil
+}
+
+func (w *testReloadWorker) Reload(previous Worker) (err error) {
+	if running := atomic.LoadInt32(w.running); running > 0 {
+		err = fmt.Errorf("%d runs are in flight", running)
+	}
+	w.reloaded <- err
+	return
+}
+
+func TestRunContextReload(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "config.yaml")
+	data := []byte(`
+pid-dir: ` + dir + `
+daemon: import
+daemons:
+  import:
+    enabled: true
+    sleep: 1s
+    workers:
+      - {name: test-reload, enabled: true, schedule: "* * * * * *", overlap: allow}
+`)
+	if err := os.WriteFile(file, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	previous := *config.Cfg()
+	defer func() { *config.Cfg() = previous }()
+	*config.Cfg() = config.Config{ConfigFiles: []string{file}}
+	if err := config.Configure(); err != nil {
+		t.Fatal(err)
+	}
+	var running int32
+	worker := &testReloadWorker{running: &running, started: make(chan struct{}), reloaded: make(chan error, 1)}
+	Factory.RegisterContext("test-reload", func() ContextWorker { return worker })
+	defer delete(Factory, "test-reload")
+	cfg := config.Cfg().Daemons["import"].Workers[0]
+	w := Adapt(NewReplica(cfg, "import", nil, 0))
+	done := make(chan error)
+	go func() { done <- RunContext(w) }()
+
+	select {
+	case <-worker.started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the run is not started")
+	}
+	_ = syscall.Kill(os.Getpid(), syscall.SIGHUP)
+	select {
+	case err := <-worker.reloaded:
+		if err != nil {
+			t.Errorf("Reload() is called while %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("the worker is not reloaded")
+	}
+	_ = syscall.Kill(os.Getpid(), syscall.SIGTERM)
+	if err := <-done; err != nil {
+		t.Errorf("RunContext() error = %v", err)
+	}
+}
+
+func TestOverMemory(t *testing.T) {
+	tests := []struct {
+		name   string
+		limit  uint64
+		result bool
+		want   bool
+	}{
+		{name: "no limit"},
+		{name: "under limit", limit: 1 << 40},
+		{name: "skipped run", limit: 1, want: true},
+		{name: "run", limit: 1, result: true, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &Worker{Name: "test", MemoryLimit: tt.limit, MemoryAction: config.MemorySkip, mu: &sync.Mutex{}}
+			var result *ResultProcess
+			if tt.result {
+				result = &ResultProcess{}
+			}
+			if got := w.overMemory(result); got != tt.want {
+				t.Fatalf("overMemory() = %v, want %v", got, tt.want)
+			}
+			err := w.lastError
+			if result != nil {
+				err = result.err
+			}
+			if tt.want != (err != nil) || tt.want != (w.metrics.MemoryBreaches == 1) {
+				t.Errorf("error = %v, breaches = %d, want the breach recorded %v", err, w.metrics.MemoryBreaches, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+package imports
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// A Pipeline fetches and processes entities of type T. It is run by a
+// PipelineWorker registered with RegisterPipeline. Optional hooks are
+// called if the pipeline implements BatchPreparer, BatchFinisher or the
+// BeforeRun and AfterRun methods of ContextWorker. The pipeline may also
+// implement Reloader, ReadinessChecker and DeadLetterSink.
+type Pipeline[T any] interface {
+	// GetEntities returns the next batch, an empty batch means there are no
+	// entities left in the run.
+	GetEntities(ctx context.Context) ([]T, error)
+	// Processing processes the batch and returns the items failed, they are
+	// retried according to the retry policy of the worker.
+	Processing(ctx context.Context, items []T) (errorItems []T, err error)
+	// ExtractId returns the id of the item.
+	ExtractId(item T) (string, error)
+}
+
+// A BatchPreparer is a Pipeline preparing the batch before processing, the
+// returned batch is processed, it is skipped if empty.
+type BatchPreparer[T any] interface {
+	BeforeProcessing(ctx context.Context, items []T) ([]T, error)
+}
+
+// A BatchFinisher is a Pipeline receiving the items failed in the batch.
+type BatchFinisher[T any] interface {
+	AfterProcessing(ctx context.Context, errorItems []T) error
+}
+
+// RegisterPipeline registers the worker running the pipeline returned by
+// factoryFunc. It panics if T is a slice type, e.g. []byte, as a batch could
+// not be told from a single item then; such items are wrapped in a struct.
+func RegisterPipeline[T any](name string, factoryFunc func() Pipeline[T]) {
+	if itemType := reflect.TypeOf((*T)(nil)).Elem(); itemType.Kind() == reflect.Slice {
+		panic(fmt.Sprintf("imports: pipeline '%s' items must not be a slice, got %s", name, itemType))
+	}
+	Factory.RegisterContext(name, func() ContextWorker {
+		return &PipelineWorker[T]{Pipeline: factoryFunc()}
+	})
+}
+
+// A PipelineWorker is a ContextWorker running a Pipeline. Batches are passed
+// to the hooks as []T, error items as T.
+type PipelineWorker[T any] struct {
+	ContextBase
+	Pipeline Pipeline[T]
+}
+
+func (w *PipelineWorker[T]) SetData(worker *Worker) {
+	w.Worker = *worker
+}
+
+func (w *PipelineWorker[T]) BeforeRun(ctx context.Context) (interface{}, error) {
+	if hook, ok := w.Pipeline.(interface {
+		BeforeRun(ctx context.Context) (interface{}, error)
+	}); ok {
+		return hook.BeforeRun(ctx)
+	}
+	return nil, nil
+}
+
+func (w *PipelineWorker[T]) AfterRun(ctx context.Context, result *ResultProcess) error {
+	if hook, ok := w.Pipeline.(interface {
+		AfterRun(ctx context.Context, result *ResultProcess) error
+	}); ok {
+		return hook.AfterRun(ctx, result)
+	}
+	return nil
+}
+
+func (w *PipelineWorker[T]) GetEntities(ctx context.Context) (interface{}, error) {
+	items, err := w.Pipeline.GetEntities(ctx)
+	if err != nil || len(items) == 0 {
+		return nil, err
+	}
+	return items, nil
+}
+
+// BeforeProcessing receives a pointer to the batch, see ContextWorker.
+func (w *PipelineWorker[T]) BeforeProcessing(ctx context.Context, data interface{}) (err error) {
+	preparer, ok := w.Pipeline.(BatchPreparer[T])
+	if !ok {
+		return
+	}
+	batch, ok := data.(*interface{})
+	if !ok {
+		return fmt.Errorf("unexpected batch %T", data)
+	}
+	var items []T
+	if items, err = toItems[T](*batch); err != nil {
+		return
+	}
+	if items, err = preparer.BeforeProcessing(ctx, items); len(items) == 0 {
+		*batch = nil
+	} else {
+		*batch = items
+	}
+	return
+}
+
+func (w *PipelineWorker[T]) Processing(ctx context.Context, data interface{}, result *ResultProcess) error {
+	items, err := toItems[T](data)
+	if err != nil {
+		return err
+	}
+	errorItems, err := w.Pipeline.Processing(ctx, items)
+	result.Total += len(items)
+	for _, item := range errorItems {
+		result.ErrorItems = append(result.ErrorItems, item)
+	}
+	return err
+}
+
+func (w *PipelineWorker[T]) AfterProcessing(ctx context.Context, errorItems interface{}) error {
+	finisher, ok := w.Pipeline.(BatchFinisher[T])
+	if !ok {
+		return nil
+	}
+	items, err := toItems[T](errorItems)
+	if err != nil {
+		return err
+	}
+	return finisher.AfterProcessing(ctx, items)
+}
+
+// ExtractId returns ids of the batch or of the item.
+func (w *PipelineWorker[T]) ExtractId(data interface{}) (ids []string, err error) {
+	var items []T
+	if items, err = toItems[T](data); err != nil {
+		return
+	}
+	for _, item := range items {
+		var id string
+		if id, err = w.Pipeline.ExtractId(item); err != nil {
+			return
+		}
+		ids = append(ids, id)
+	}
+	return
+}
+
+// RetryBatch returns the batch of the failed item, see RetryBatcher. The
+// item restored after restart is decoded from its JSON.
+func (w *PipelineWorker[T]) RetryBatch(item interface{}) (interface{}, error) {
+	if data, ok := item.(json.RawMessage); ok {
+		var decoded T
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			return nil, err
+		}
+		item = decoded
+	}
+	return toItems[T](item)
+}
+
+func (w *PipelineWorker[T]) unwrap() interface{} {
+	return w.Pipeline
+}
+
+// toItems converts a batch, a single item or error items to []T, T is not a
+// slice, see RegisterPipeline.
+func toItems[T any](data interface{}) (items []T, err error) {
+	switch value := data.(type) {
+	case nil:
+	case []T:
+		items = value
+	case T:
+		items = []T{value}
+	case []interface{}:
+		for _, element := range value {
+			item, ok := element.(T)
+			if !ok {
+				return nil, fmt.Errorf("unexpected item %T", element)
+			}
+			items = append(items, item)
+		}
+	default:
+		err = fmt.Errorf("unexpected batch %T", data)
+	}
+	return
+}
@@ -0,0 +1,88 @@
+package imports
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+type testItem struct {
+	ID string
+}
+
+func TestToItems(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    interface{}
+		want    []testItem
+		wantErr bool
+	}{
+		{name: "nil"},
+		{name: "batch", data: []testItem{{"1"}, {"2"}}, want: []testItem{{"1"}, {"2"}}},
+		{name: "item", data: testItem{"1"}, want: []testItem{{"1"}}},
+		{name: "error items", data: []interface{}{testItem{"1"}, testItem{"2"}}, want: []testItem{{"1"}, {"2"}}},
+		{name: "unexpected item", data: []interface{}{testItem{"1"}, "2"}, wantErr: true},
+		{name: "unexpected batch", data: "1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := toItems[testItem](tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("toItems() error = %v, want error %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("toItems() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPipelineRetryBatch(t *testing.T) {
+	w := &PipelineWorker[testItem]{}
+	tests := []struct {
+		name    string
+		item    interface{}
+		want    interface{}
+		wantErr bool
+	}{
+		{name: "item", item: testItem{"1"}, want: []testItem{{"1"}}},
+		{name: "restored item", item: json.RawMessage(`{"ID":"1"}`), want: []testItem{{"1"}}},
+		{name: "invalid restored item", item: json.RawMessage(`[]`), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := w.RetryBatch(tt.item)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RetryBatch() error = %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("RetryBatch() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+type testBytesPipeline struct{}
+
+func (testBytesPipeline) GetEntities(context.Context) ([][]byte, error) {
+	return nil, nil
+}
+
+func (testBytesPipeline) Processing(context.Context, [][]byte) ([][]byte, error) {
+	return nil, nil
+}
+
+func (testBytesPipeline) ExtractId([]byte) (string, error) {
+	return ``, nil
+}
+
+func TestRegisterPipelineSlice(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("RegisterPipeline() of []byte items does not panic")
+		}
+		delete(Factory, "test-bytes")
+	}()
+	RegisterPipeline[[]byte]("test-bytes", func() Pipeline[[]byte] { return testBytesPipeline{} })
+}
@@ -0,0 +1,177 @@
+package imports
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// A ContextProcessor is implemented by workers which stop processing of a
+// batch when its context is cancelled. The context is cancelled with the
+// context of the run, see ContextWorker, or when the batch is processed
+// longer than BatchTimeout of the worker, every batch has its own deadline.
+// It is used instead of Processing of a WorkerInterface.
+type ContextProcessor interface {
+	ProcessingContext(ctx context.Context, data interface{}, result *ResultProcess) error
+}
+
+// A job is a batch of entities returned by GetEntities.
+type job struct {
+	seq int
+	// origin is the number of the fetched batch, see progress.
+	origin int
+	data   interface{}
+	retry  *retry
+	batch  ResultProcess
+	errs   []hookError
+	// duration of BeforeProcessing and Processing of the batch.
+	duration time.Duration
+	// messages of the batch consumed from the queue backend.
+	messages []Message
+	queue    Queue
+}
+
+type hookError struct {
+	err  error
+	hook string
+}
+
+func (j *job) fail(err error, hook string) {
+	j.errs = append(j.errs, hookError{err: err, hook: hook})
+}
+
+// run calls BeforeProcessing and Processing of the batch. Errors are kept
+// in the job, so run may be called concurrently.
+func (j *job) run(ctx context.Context, w ContextWorker) {
+	started := time.Now()
+	defer func() {
+		j.duration = time.Since(started)
+	}()
+	wd := w.Data()
+	j.batch.Queue = wd.Queue
+	if err := w.BeforeProcessing(ctx, &j.data); err != nil {
+		j.fail(err, "BeforeProcessing")
+	}
+	if j.data == nil {
+		return
+	}
+	if wd.BatchTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, wd.BatchTimeout)
+		defer cancel()
+	}
+	if err := w.Processing(ctx, j.data, &j.batch); err != nil {
+		j.fail(err, "")
+	}
+}
+
+// complete calls AfterProcessing of the processed batch, schedules retries
+// of its failed items, saves the checkpoint and adds the batch to the result
+// of the run.
+func (j *job) complete(ctx context.Context, w ContextWorker, result *ResultProcess) {
+	wd := w.Data()
+	if err := w.AfterProcessing(ctx, j.batch.ErrorItems); err != nil {
+		j.fail(err, "AfterProcessing")
+	}
+	wd.retryFailed(w, j)
+	if err := wd.saveCheckpoint(w, j); err != nil {
+		wd.fail(result, err, "ExtractId")
+	}
+	wd.settle(j, result)
+	wd.mu.Lock()
+	wd.observeBatch(j.duration)
+	wd.mu.Unlock()
+	for _, hookErr := range j.errs {
+		wd.fail(result, hookErr.err, hookErr.hook)
+	}
+	result.Total += j.batch.Total
+	result.ErrorItems = append(result.ErrorItems, j.batch.ErrorItems...)
+	if wd.health != nil {
+		wd.health.Tick()
+	}
+}
+
+// processSerial fetches and processes batches one by one.
+func processSerial(ctx context.Context, w ContextWorker, result *ResultProcess) (errorData error) {
+	wd := w.Data()
+	for !wd.overMemory(result) {
+		var j *job
+		if j, errorData = next(ctx, w); errorData != nil || j == nil {
+			return
+		}
+		j.run(ctx, w)
+		j.complete(ctx, w, result)
+		if ctx.Err() != nil {
+			return
+		}
+		runtime.GC()
+	}
+	return
+}
+
+// processPool fetches batches and processes them by Concurrency goroutines.
+// BeforeProcessing and Processing are called concurrently, GetEntities and
+// AfterProcessing are called from the calling goroutine only, AfterProcessing
+// in order of fetching if Ordered is set. At most Concurrency + Buffer
+// batches are fetched and not completed at a time, Buffer defaults to
+// Concurrency. Batches are processed serially if Concurrency is less than 2.
+func processPool(ctx context.Context, w ContextWorker, result *ResultProcess) (errorData error) {
+	wd := w.Data()
+	buffer := wd.Buffer
+	if buffer <= 0 {
+		buffer = wd.Concurrency
+	}
+	limit := wd.Concurrency + buffer
+	jobs := make(chan *job, limit)
+	finished := make(chan *job, limit)
+	var wg sync.WaitGroup
+	for i := 0; i < wd.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				j.run(ctx, w)
+				finished <- j
+			}
+		}()
+	}
+	defer func() {
+		close(jobs)
+		wg.Wait()
+	}()
+
+	pending := make(map[int]*job)
+	fetching, fetched, completed := true, 0, 0
+	for {
+		for fetching && fetched-completed < limit {
+			if ctx.Err() != nil || wd.overMemory(result) {
+				fetching = false
+				break
+			}
+			var j *job
+			if j, errorData = next(ctx, w); errorData != nil || j == nil {
+				fetching = false
+				break
+			}
+			j.seq = fetched
+			jobs <- j
+			fetched++
+		}
+		if fetched == completed {
+			return
+		}
+		j := <-finished
+		if !wd.Ordered {
+			j.complete(ctx, w, result)
+			completed++
+			continue
+		}
+		pending[j.seq] = j
+		for j, ok := pending[completed]; ok; j, ok = pending[completed] {
+			delete(pending, completed)
+			j.complete(ctx, w, result)
+			completed++
+		}
+	}
+}
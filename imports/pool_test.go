@@ -0,0 +1,110 @@
+package imports
+
+import (
+	"github.com/phantom-d/go-daemons/config"
+
+	"context"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testPoolWorker fetches numbered batches, later batches are processed
+// faster. Processing returns the number of the batch as its error item, so
+// error items of the result are in order of completion.
+type testPoolWorker struct {
+	ContextBase
+	batches     int
+	fetched     int
+	inFlight    int
+	maxInFlight int
+}
+
+func (w *testPoolWorker) GetEntities(ctx context.Context) (interface{}, error) {
+	if w.fetched == w.batches {
+		return nil, nil
+	}
+	w.fetched++
+	if w.inFlight++; w.inFlight > w.maxInFlight {
+		w.maxInFlight = w.inFlight
+	}
+	return w.fetched - 1, nil
+}
+
+func (w *testPoolWorker) ExtractId(interface{}) ([]string, error) {
+	return nil, nil
+}
+
+func (w *testPoolWorker) Processing(ctx context.Context, data interface{}, result *ResultProcess) error {
+	batch := data.(int)
+	time.Sleep(time.Duration(w.batches-batch) * time.Millisecond)
+	result.Total++
+	result.ErrorItems = []interface{}{batch}
+	return nil
+}
+
+func (w *testPoolWorker) AfterProcessing(ctx context.Context, errorItems interface{}) error {
+	w.inFlight--
+	return nil
+}
+
+func (w *testPoolWorker) SetData(worker *Worker) {
+	w.Worker = *worker
+}
+
+func TestProcessPool(t *testing.T) {
+	tests := []struct {
+		name        string
+		concurrency int
+		buffer      int
+		ordered     bool
+	}{
+		{name: "ordered", concurrency: 3, buffer: 1, ordered: true},
+		{name: "unordered", concurrency: 3, buffer: 1},
+		{name: "default buffer", concurrency: 2, ordered: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &testPoolWorker{batches: 12}
+			w.Worker = Worker{
+				Name:        "test",
+				Concurrency: tt.concurrency,
+				Buffer:      tt.buffer,
+				Ordered:     tt.ordered,
+				Context:     &config.Context{Name: "test"},
+				mu:          &sync.Mutex{},
+			}
+			result := &ResultProcess{}
+			if err := processPool(context.Background(), w, result); err != nil {
+				t.Fatal(err)
+			}
+			if result.Total != w.batches {
+				t.Errorf("total = %d, want %d", result.Total, w.batches)
+			}
+			var order []int
+			for _, item := range result.ErrorItems {
+				order = append(order, item.(int))
+			}
+			if tt.ordered && !sort.IntsAreSorted(order) {
+				t.Errorf("batches are completed in order %v, want the order of fetching", order)
+			}
+			sort.Ints(order)
+			for i, batch := range order {
+				if batch != i {
+					t.Fatalf("completed batches = %v, want every batch once", order)
+				}
+			}
+			limit := tt.concurrency + tt.buffer
+			if tt.buffer == 0 {
+				limit = 2 * tt.concurrency
+			}
+			if w.maxInFlight > limit {
+				t.Errorf("batches in flight = %d, want at most %d", w.maxInFlight, limit)
+			}
+			if histogram := w.metrics.BatchDuration; histogram == nil || histogram.Count != uint64(w.batches) {
+				t.Errorf("batch durations = %+v, want %d observed", histogram, w.batches)
+			}
+		})
+	}
+}
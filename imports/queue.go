@@ -0,0 +1,308 @@
+package imports
+
+import (
+	"github.com/phantom-d/go-daemons/config"
+
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultQueueBatch is the number of messages consumed for a batch if the
+// queue URL has no "batch" parameter.
+const DefaultQueueBatch = 100
+
+// queueTimeout limits acknowledgements of the messages, they are sent also
+// when the run is cancelled.
+const queueTimeout = 10 * time.Second
+
+// A Message is an entity consumed from a queue.
+type Message struct {
+	ID   string `json:"id"`
+	Body []byte `json:"body"`
+}
+
+// A Queue is a backend of the worker Queue. If Queue of the worker is a URL
+// with a registered scheme, e.g. "memory://jobs" or "redis://host:6379/jobs",
+// the run loop consumes batches of []Message from it instead of calling
+// GetEntities. Messages of the batch are acknowledged after AfterProcessing,
+// messages returned in ErrorItems are negatively acknowledged after the run
+// unless the retry policy of the worker is enabled, messages of a batch
+// failed by a hook are requeued after the run.
+type Queue interface {
+	// Consume returns at most limit messages, none if the queue is empty.
+	Consume(ctx context.Context, limit int) ([]Message, error)
+	// Ack removes processed messages from the queue.
+	Ack(ctx context.Context, messages []Message) error
+	// Nack returns failed messages to the queue for redelivery.
+	Nack(ctx context.Context, messages []Message) error
+	// Requeue returns messages which have not been processed to the queue.
+	Requeue(ctx context.Context, messages []Message) error
+	// Publish appends messages with given bodies to the queue.
+	Publish(ctx context.Context, bodies ...[]byte) error
+	Close() error
+}
+
+// A QueueOpener opens the queue of the worker by its URL.
+type QueueOpener func(u *url.URL, worker *Worker) (Queue, error)
+
+var (
+	queueMu      sync.Mutex
+	queueOpeners = map[string]QueueOpener{}
+)
+
+func init() {
+	RegisterQueue("memory", openMemoryQueue)
+	RegisterQueue("redis", openRedisQueue)
+	RegisterQueue("disk", openDiskQueue)
+}
+
+// RegisterQueue registers the queue backend for the URL scheme.
+func RegisterQueue(scheme string, opener QueueOpener) {
+	queueMu.Lock()
+	defer queueMu.Unlock()
+	queueOpeners[scheme] = opener
+}
+
+// ParseQueue returns the URL of the queue backend, nil if the queue is only
+// a name. Returns an error if the URL is invalid or its scheme is not
+// registered.
+func ParseQueue(queue string) (u *url.URL, err error) {
+	if !strings.Contains(queue, "://") {
+		return
+	}
+	if u, err = url.Parse(queue); err != nil {
+		return
+	}
+	queueMu.Lock()
+	defer queueMu.Unlock()
+	if _, ok := queueOpeners[u.Scheme]; !ok {
+		return nil, fmt.Errorf("unknown queue backend %q", u.Scheme)
+	}
+	return
+}
+
+// OpenQueue opens the queue backend of the worker, nil if the worker Queue
+// is only a name.
+func OpenQueue(worker *Worker) (queue Queue, err error) {
+	var u *url.URL
+	if u, err = ParseQueue(worker.Queue); err != nil || u == nil {
+		return
+	}
+	queueMu.Lock()
+	opener := queueOpeners[u.Scheme]
+	queueMu.Unlock()
+	return opener(u, worker)
+}
+
+// redactQueue hides the password of the queue URL.
+func redactQueue(queue string) string {
+	if u, err := ParseQueue(queue); err == nil && u != nil {
+		return u.Redacted()
+	}
+	return queue
+}
+
+// queueBatch returns the "batch" parameter of the queue URL.
+func queueBatch(worker *Worker) int {
+	if u, err := ParseQueue(worker.Queue); err == nil && u != nil {
+		if batch, err := strconv.Atoi(u.Query().Get("batch")); err == nil && batch > 0 {
+			return batch
+		}
+	}
+	return DefaultQueueBatch
+}
+
+// consume returns the job of the next batch of messages of the worker queue,
+// nil if the queue is empty. The queue is opened on first use.
+func (w *Worker) consume(ctx context.Context) (j *job, err error) {
+	w.mu.Lock()
+	if w.queue == nil {
+		if w.queue, err = OpenQueue(w); err != nil {
+			w.mu.Unlock()
+			return nil, fmt.Errorf("open queue: %w", err)
+		}
+	}
+	queue := w.queue
+	w.mu.Unlock()
+	var messages []Message
+	if messages, err = queue.Consume(ctx, queueBatch(w)); err != nil || len(messages) == 0 {
+		return
+	}
+	return &job{data: messages, messages: messages, queue: queue}, nil
+}
+
+// A redelivery is a set of messages returned to the queue after the run.
+type redelivery struct {
+	queue    Queue
+	messages []Message
+	requeue  bool
+}
+
+// settle acknowledges messages of the completed job to the queue they were
+// consumed from. Messages failed or not processed are returned to the queue
+// after the run, so they are not consumed again by the same run.
+func (w *Worker) settle(j *job, result *ResultProcess) {
+	if len(j.messages) == 0 {
+		return
+	}
+	if len(j.errs) > 0 {
+		result.redeliveries = append(result.redeliveries, redelivery{queue: j.queue, messages: j.messages, requeue: true})
+		return
+	}
+	failed := make(map[string]bool)
+	for _, item := range j.batch.ErrorItems {
+		switch message := item.(type) {
+		case Message:
+			failed[message.ID] = true
+		case *Message:
+			failed[message.ID] = true
+		}
+	}
+	var acked, nacked []Message
+	for _, message := range j.messages {
+		if failed[message.ID] && !w.Retry.Enabled() {
+			nacked = append(nacked, message)
+		} else {
+			acked = append(acked, message)
+		}
+	}
+	if len(nacked) > 0 {
+		result.redeliveries = append(result.redeliveries, redelivery{queue: j.queue, messages: nacked})
+	}
+	if len(acked) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), queueTimeout)
+	defer cancel()
+	if err := j.queue.Ack(ctx, acked); err != nil {
+		config.Log().Error().Err(err).Msgf("Worker '%s' acknowledge messages", w.Name)
+	}
+}
+
+// redeliver returns messages failed in the run to the queue.
+func (w *Worker) redeliver(result *ResultProcess) {
+	if len(result.redeliveries) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), queueTimeout)
+	defer cancel()
+	for _, r := range result.redeliveries {
+		var err error
+		if r.requeue {
+			err = r.queue.Requeue(ctx, r.messages)
+		} else {
+			err = r.queue.Nack(ctx, r.messages)
+		}
+		if err != nil {
+			config.Log().Error().Err(err).Msgf("Worker '%s' return messages to queue", w.Name)
+		}
+	}
+}
+
+// closeQueue closes the queue backend of the worker if it is open.
+func (w *Worker) closeQueue() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.queue == nil {
+		return
+	}
+	if err := w.queue.Close(); err != nil {
+		config.Log().Error().Err(err).Msgf("Worker '%s' close queue", w.Name)
+	}
+	w.queue = nil
+}
+
+// A MemoryQueue is a queue backend keeping messages in memory of the
+// process, queues with the same name share messages. It is opened by
+// "memory://<name>" URL and is intended for tests.
+type MemoryQueue struct {
+	mu       sync.Mutex
+	seq      int
+	ready    []Message
+	inFlight map[string]Message
+}
+
+var memoryQueues = map[string]*MemoryQueue{}
+
+// NewMemoryQueue returns the memory queue with given name.
+func NewMemoryQueue(name string) *MemoryQueue {
+	queueMu.Lock()
+	defer queueMu.Unlock()
+	queue, ok := memoryQueues[name]
+	if !ok {
+		queue = &MemoryQueue{inFlight: make(map[string]Message)}
+		memoryQueues[name] = queue
+	}
+	return queue
+}
+
+func openMemoryQueue(u *url.URL, worker *Worker) (Queue, error) {
+	return NewMemoryQueue(u.Host + u.Path), nil
+}
+
+func (q *MemoryQueue) Consume(ctx context.Context, limit int) (messages []Message, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if limit > len(q.ready) {
+		limit = len(q.ready)
+	}
+	messages = append(messages, q.ready[:limit]...)
+	q.ready = q.ready[limit:]
+	for _, message := range messages {
+		q.inFlight[message.ID] = message
+	}
+	return
+}
+
+func (q *MemoryQueue) Ack(ctx context.Context, messages []Message) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, message := range messages {
+		delete(q.inFlight, message.ID)
+	}
+	return nil
+}
+
+func (q *MemoryQueue) Nack(ctx context.Context, messages []Message) error {
+	return q.Requeue(ctx, messages)
+}
+
+func (q *MemoryQueue) Requeue(ctx context.Context, messages []Message) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, message := range messages {
+		if _, ok := q.inFlight[message.ID]; ok {
+			delete(q.inFlight, message.ID)
+			q.ready = append(q.ready, message)
+		}
+	}
+	return nil
+}
+
+func (q *MemoryQueue) Publish(ctx context.Context, bodies ...[]byte) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, body := range bodies {
+		q.seq++
+		q.ready = append(q.ready, Message{ID: strconv.Itoa(q.seq), Body: body})
+	}
+	return nil
+}
+
+// Len returns the number of messages waiting in the queue and consumed but
+// not acknowledged.
+func (q *MemoryQueue) Len() (ready, inFlight int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.ready), len(q.inFlight)
+}
+
+// Close keeps messages of the queue, so it may be opened again.
+func (q *MemoryQueue) Close() error {
+	return nil
+}
@@ -0,0 +1,413 @@
+package imports
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// redisDialTimeout limits connecting to the server without a context
+// deadline.
+const redisDialTimeout = 5 * time.Second
+
+// A RedisError is an error reply of the server.
+type RedisError string
+
+func (e RedisError) Error() string {
+	return string(e)
+}
+
+// A respConn is a connection to a server speaking the Redis serialization
+// protocol. Commands are sent one by one, the connection is re-established
+// after a network error.
+type respConn struct {
+	mu       sync.Mutex
+	address  string
+	password string
+	db       int
+	conn     net.Conn
+	reader   *bufio.Reader
+}
+
+// do sends the command and returns the reply: string, int64, []byte, nil or
+// []interface{} of them. An error reply is returned as RedisError.
+func (c *respConn) do(ctx context.Context, args ...string) (reply interface{}, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		if err = c.dial(ctx); err != nil {
+			return
+		}
+	}
+	if reply, err = c.command(ctx, args...); err != nil {
+		var redisErr RedisError
+		if !errors.As(err, &redisErr) {
+			_ = c.conn.Close()
+			c.conn = nil
+		}
+	}
+	return
+}
+
+func (c *respConn) dial(ctx context.Context) (err error) {
+	dialer := net.Dialer{Timeout: redisDialTimeout}
+	if c.conn, err = dialer.DialContext(ctx, "tcp", c.address); err != nil {
+		return
+	}
+	c.reader = bufio.NewReader(c.conn)
+	if c.password != `` {
+		_, err = c.command(ctx, "AUTH", c.password)
+	}
+	if err == nil && c.db != 0 {
+		_, err = c.command(ctx, "SELECT", strconv.Itoa(c.db))
+	}
+	if err != nil {
+		_ = c.conn.Close()
+		c.conn = nil
+	}
+	return
+}
+
+func (c *respConn) command(ctx context.Context, args ...string) (interface{}, error) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(queueTimeout)
+	}
+	if err := c.conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+	var request strings.Builder
+	fmt.Fprintf(&request, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&request, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(c.conn, request.String()); err != nil {
+		return nil, err
+	}
+	return c.read()
+}
+
+func (c *respConn) read() (interface{}, error) {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == `` {
+		return nil, errors.New("resp: empty reply")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, RedisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size < 0 {
+			return nil, err
+		}
+		data := make([]byte, size+2)
+		if _, err = io.ReadFull(c.reader, data); err != nil {
+			return nil, err
+		}
+		return data[:size], nil
+	case '*':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size < 0 {
+			return nil, err
+		}
+		values := make([]interface{}, size)
+		for i := range values {
+			if values[i], err = c.read(); err != nil {
+				var redisErr RedisError
+				if !errors.As(err, &redisErr) {
+					return nil, err
+				}
+				values[i] = redisErr
+			}
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("resp: unexpected reply %q", line)
+}
+
+func (c *respConn) close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
+
+// A RedisQueue is a queue backend on a Redis server or another server
+// speaking its protocol. It is opened by the URL
+//
+//	redis://[:password@]host:port/key?db=0&batch=100&mode=list
+//
+// In the "list" mode messages are moved from the list to the processing list
+// of the consumer by RPOPLPUSH and removed from it by LREM when acknowledged,
+// messages left there by a crashed consumer are requeued by its first
+// Consume. Bodies are published wrapped in a JSON envelope with a unique id,
+// so acknowledging a message removes only its entry, while entries pushed by
+// other producers are consumed as bodies. In the "stream" mode messages are
+// read by XREADGROUP of the "group" parameter, "daemons" by default, and
+// acknowledged by XACK; pending messages of the consumer are delivered again
+// by its first Consume.
+type RedisQueue struct {
+	conn       *respConn
+	key        string
+	stream     bool
+	group      string
+	consumer   string
+	processing string
+	// pending is set until messages left by the previous consumer with the
+	// same name are recovered. In the stream mode they are read after
+	// pendingID, so a message is not delivered twice before it is
+	// acknowledged.
+	pending   bool
+	pendingID string
+	// entries are list entries of consumed messages by their ids.
+	mu      sync.Mutex
+	entries map[string]string
+}
+
+// A redisEnvelope is a list entry of a published body.
+type redisEnvelope struct {
+	ID   string `json:"go-daemons-id"`
+	Body []byte `json:"body"`
+}
+
+// redisMessage returns the message of the list entry.
+func redisMessage(entry []byte) (message Message, err error) {
+	var envelope redisEnvelope
+	decoder := json.NewDecoder(bytes.NewReader(entry))
+	decoder.DisallowUnknownFields()
+	if decoder.Decode(&envelope) == nil && envelope.ID != `` {
+		return Message{ID: envelope.ID, Body: envelope.Body}, nil
+	}
+	if message.ID, err = newMessageID(); err == nil {
+		message.Body = entry
+	}
+	return
+}
+
+func newMessageID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return ``, err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+func openRedisQueue(u *url.URL, worker *Worker) (Queue, error) {
+	query := u.Query()
+	q := &RedisQueue{
+		conn:     &respConn{address: u.Host},
+		key:      strings.TrimPrefix(u.Path, "/"),
+		group:    query.Get("group"),
+		consumer: fmt.Sprintf("%s_%s_%d", worker.Parent, worker.Name, worker.Replica),
+		entries:  make(map[string]string),
+	}
+	if q.key == `` {
+		return nil, errors.New("redis queue: key is not set")
+	}
+	if _, _, err := net.SplitHostPort(q.conn.address); err != nil {
+		q.conn.address = net.JoinHostPort(q.conn.address, "6379")
+	}
+	if password, ok := u.User.Password(); ok {
+		q.conn.password = password
+	}
+	if db := query.Get("db"); db != `` {
+		var err error
+		if q.conn.db, err = strconv.Atoi(db); err != nil {
+			return nil, fmt.Errorf("redis queue: invalid db %q", db)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), queueTimeout)
+	defer cancel()
+	switch mode := query.Get("mode"); mode {
+	case ``, "list":
+		q.processing = q.key + ":processing:" + q.consumer
+		q.pending = true
+		return q, nil
+	case "stream":
+		q.stream, q.pending, q.pendingID = true, true, "0"
+		if q.group == `` {
+			q.group = "daemons"
+		}
+		_, err := q.conn.do(ctx, "XGROUP", "CREATE", q.key, q.group, "0", "MKSTREAM")
+		if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+			return nil, err
+		}
+		return q, nil
+	default:
+		return nil, fmt.Errorf("redis queue: unknown mode %q", mode)
+	}
+}
+
+// recover requeues messages left in the processing list.
+func (q *RedisQueue) recover(ctx context.Context) error {
+	for {
+		reply, err := q.conn.do(ctx, "RPOPLPUSH", q.processing, q.key)
+		if err != nil || reply == nil {
+			return err
+		}
+	}
+}
+
+func (q *RedisQueue) Consume(ctx context.Context, limit int) (messages []Message, err error) {
+	if q.stream {
+		return q.read(ctx, limit)
+	}
+	if q.pending {
+		if err = q.recover(ctx); err != nil {
+			return
+		}
+		q.pending = false
+	}
+	for len(messages) < limit {
+		var reply interface{}
+		if reply, err = q.conn.do(ctx, "RPOPLPUSH", q.key, q.processing); err != nil || reply == nil {
+			return
+		}
+		entry, _ := reply.([]byte)
+		var message Message
+		if message, err = redisMessage(entry); err != nil {
+			return
+		}
+		q.mu.Lock()
+		q.entries[message.ID] = string(entry)
+		q.mu.Unlock()
+		messages = append(messages, message)
+	}
+	return
+}
+
+// read reads messages of the stream, pending messages of the consumer first.
+func (q *RedisQueue) read(ctx context.Context, limit int) (messages []Message, err error) {
+	id := ">"
+	if q.pending {
+		id = q.pendingID
+	}
+	var reply interface{}
+	reply, err = q.conn.do(ctx, "XREADGROUP", "GROUP", q.group, q.consumer, "COUNT", strconv.Itoa(limit), "STREAMS", q.key, id)
+	if err != nil {
+		return
+	}
+	// The reply is [[key, [[id, [field, value, ...]], ...]]].
+	streams, _ := reply.([]interface{})
+	for _, stream := range streams {
+		fields, _ := stream.([]interface{})
+		if len(fields) < 2 {
+			continue
+		}
+		entries, _ := fields[1].([]interface{})
+		for _, entry := range entries {
+			parts, _ := entry.([]interface{})
+			if len(parts) < 2 {
+				continue
+			}
+			id, _ := parts[0].([]byte)
+			message := Message{ID: string(id)}
+			values, _ := parts[1].([]interface{})
+			for i := 0; i+1 < len(values); i += 2 {
+				if name, _ := values[i].([]byte); string(name) == "body" {
+					message.Body, _ = values[i+1].([]byte)
+				}
+			}
+			messages = append(messages, message)
+		}
+	}
+	if q.pending && len(messages) > 0 {
+		q.pendingID = messages[len(messages)-1].ID
+	}
+	if q.pending && len(messages) == 0 {
+		q.pending = false
+		return q.read(ctx, limit)
+	}
+	return
+}
+
+func (q *RedisQueue) Ack(ctx context.Context, messages []Message) (err error) {
+	if q.stream {
+		args := []string{"XACK", q.key, q.group}
+		for _, message := range messages {
+			args = append(args, message.ID)
+		}
+		_, err = q.conn.do(ctx, args...)
+		return
+	}
+	for _, message := range messages {
+		q.mu.Lock()
+		entry, ok := q.entries[message.ID]
+		q.mu.Unlock()
+		if !ok {
+			continue
+		}
+		if _, err = q.conn.do(ctx, "LREM", q.processing, "1", entry); err != nil {
+			return
+		}
+		q.mu.Lock()
+		delete(q.entries, message.ID)
+		q.mu.Unlock()
+	}
+	return
+}
+
+func (q *RedisQueue) Nack(ctx context.Context, messages []Message) error {
+	return q.Requeue(ctx, messages)
+}
+
+// Requeue appends the messages to the queue again and acknowledges them.
+func (q *RedisQueue) Requeue(ctx context.Context, messages []Message) (err error) {
+	bodies := make([][]byte, 0, len(messages))
+	for _, message := range messages {
+		bodies = append(bodies, message.Body)
+	}
+	if err = q.Publish(ctx, bodies...); err != nil {
+		return
+	}
+	return q.Ack(ctx, messages)
+}
+
+func (q *RedisQueue) Publish(ctx context.Context, bodies ...[]byte) (err error) {
+	for _, body := range bodies {
+		if q.stream {
+			_, err = q.conn.do(ctx, "XADD", q.key, "*", "body", string(body))
+		} else {
+			envelope := redisEnvelope{Body: body}
+			var entry []byte
+			if envelope.ID, err = newMessageID(); err == nil {
+				entry, err = json.Marshal(envelope)
+			}
+			if err == nil {
+				_, err = q.conn.do(ctx, "LPUSH", q.key, string(entry))
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (q *RedisQueue) Close() error {
+	return q.conn.close()
+}
@@ -0,0 +1,423 @@
+package imports
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeRedis serves list and stream commands of the Redis protocol used by
+// RedisQueue.
+type fakeRedis struct {
+	mu      sync.Mutex
+	lists   map[string][]string
+	streams map[string]*fakeStream
+}
+
+// A fakeStream holds entries with ids "<n>-0" numbered from 1 and consumer
+// groups.
+type fakeStream struct {
+	bodies []string
+	groups map[string]*fakeGroup
+}
+
+// A fakeGroup holds the number of the last delivered entry and consumers of
+// the pending entries by their numbers.
+type fakeGroup struct {
+	last    int
+	pending map[int]string
+}
+
+func streamID(n int) string {
+	return fmt.Sprintf("%d-0", n)
+}
+
+func streamNumber(id string) int {
+	n, _ := strconv.Atoi(strings.TrimSuffix(id, "-0"))
+	return n
+}
+
+// respReply encodes strings as bulk strings, nil as a nil array and slices as
+// arrays.
+func respReply(value interface{}) string {
+	switch value := value.(type) {
+	case string:
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+	case []interface{}:
+		reply := fmt.Sprintf("*%d\r\n", len(value))
+		for _, item := range value {
+			reply += respReply(item)
+		}
+		return reply
+	}
+	return "*-1\r\n"
+}
+
+func startFakeRedis(t *testing.T) (server *fakeRedis, address string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+	server = &fakeRedis{lists: make(map[string][]string), streams: make(map[string]*fakeStream)}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+	return server, listener.Addr().String()
+}
+
+func (s *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for {
+		args, err := readCommand(reader)
+		if err != nil {
+			return
+		}
+		if _, err = io.WriteString(conn, s.do(args)); err != nil {
+			return
+		}
+	}
+}
+
+func readCommand(reader *bufio.Reader) (args []string, err error) {
+	var line string
+	if line, err = reader.ReadString('\n'); err != nil {
+		return
+	}
+	count, _ := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "*")))
+	for i := 0; i < count; i++ {
+		if line, err = reader.ReadString('\n'); err != nil {
+			return
+		}
+		size, _ := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "$")))
+		data := make([]byte, size+2)
+		if _, err = io.ReadFull(reader, data); err != nil {
+			return
+		}
+		args = append(args, string(data[:size]))
+	}
+	return
+}
+
+func (s *fakeRedis) do(args []string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch strings.ToUpper(args[0]) {
+	case "LPUSH":
+		for _, value := range args[2:] {
+			s.lists[args[1]] = append([]string{value}, s.lists[args[1]]...)
+		}
+		return fmt.Sprintf(":%d\r\n", len(s.lists[args[1]]))
+	case "RPOPLPUSH":
+		source := s.lists[args[1]]
+		if len(source) == 0 {
+			return "$-1\r\n"
+		}
+		value := source[len(source)-1]
+		s.lists[args[1]] = source[:len(source)-1]
+		s.lists[args[2]] = append([]string{value}, s.lists[args[2]]...)
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+	case "LREM":
+		count, _ := strconv.Atoi(args[2])
+		var kept []string
+		removed := 0
+		for _, value := range s.lists[args[1]] {
+			if value == args[3] && removed < count {
+				removed++
+				continue
+			}
+			kept = append(kept, value)
+		}
+		s.lists[args[1]] = kept
+		return fmt.Sprintf(":%d\r\n", removed)
+	case "XGROUP":
+		// XGROUP CREATE key group 0 MKSTREAM
+		stream, ok := s.streams[args[2]]
+		if !ok {
+			stream = &fakeStream{groups: make(map[string]*fakeGroup)}
+			s.streams[args[2]] = stream
+		}
+		if _, ok = stream.groups[args[3]]; ok {
+			return "-BUSYGROUP Consumer Group name already exists\r\n"
+		}
+		stream.groups[args[3]] = &fakeGroup{pending: make(map[int]string)}
+		return "+OK\r\n"
+	case "XADD":
+		// XADD key * body value
+		stream := s.streams[args[1]]
+		stream.bodies = append(stream.bodies, args[4])
+		return respReply(streamID(len(stream.bodies)))
+	case "XREADGROUP":
+		// XREADGROUP GROUP group consumer COUNT count STREAMS key id
+		stream := s.streams[args[7]]
+		group, consumer := stream.groups[args[2]], args[3]
+		count, _ := strconv.Atoi(args[5])
+		var entries []interface{}
+		entry := func(n int) {
+			body := []interface{}{"body", stream.bodies[n-1]}
+			entries = append(entries, []interface{}{streamID(n), body})
+		}
+		if args[8] == ">" {
+			for group.last < len(stream.bodies) && len(entries) < count {
+				group.last++
+				group.pending[group.last] = consumer
+				entry(group.last)
+			}
+			if len(entries) == 0 {
+				return respReply(nil)
+			}
+		} else {
+			for n := streamNumber(args[8]) + 1; n <= group.last && len(entries) < count; n++ {
+				if group.pending[n] == consumer {
+					entry(n)
+				}
+			}
+		}
+		if entries == nil {
+			entries = []interface{}{}
+		}
+		return respReply([]interface{}{[]interface{}{args[7], entries}})
+	case "XACK":
+		// XACK key group id...
+		group := s.streams[args[1]].groups[args[2]]
+		acked := 0
+		for _, id := range args[3:] {
+			if _, ok := group.pending[streamNumber(id)]; ok {
+				delete(group.pending, streamNumber(id))
+				acked++
+			}
+		}
+		return fmt.Sprintf(":%d\r\n", acked)
+	}
+	return "-ERR unknown command\r\n"
+}
+
+// pending returns the number of the pending entries of the stream group.
+func (s *fakeRedis) pending(key, group string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.streams[key].groups[group].pending)
+}
+
+func (s *fakeRedis) len(key string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.lists[key])
+}
+
+func openTestRedisQueue(t *testing.T, address string) *RedisQueue {
+	return openTestRedisURL(t, "redis://"+address+"/jobs")
+}
+
+func openTestRedisURL(t *testing.T, rawURL string) *RedisQueue {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	queue, err := openRedisQueue(u, &Worker{Name: "test", Parent: "import"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = queue.Close() })
+	return queue.(*RedisQueue)
+}
+
+func TestRedisQueueList(t *testing.T) {
+	tests := []struct {
+		name   string
+		push   []string
+		bodies []string
+		ack    int
+		nack   int
+		// ready and processing are lengths of the lists after the
+		// acknowledgements.
+		ready      int
+		processing int
+	}{
+		{
+			name:       "duplicate bodies acknowledged one by one",
+			bodies:     []string{"same", "same"},
+			ack:        1,
+			processing: 1,
+		},
+		{
+			name:   "all acknowledged",
+			bodies: []string{"a", "b", "a"},
+			ack:    3,
+		},
+		{
+			name:   "nacked is published again",
+			bodies: []string{"a", "a"},
+			ack:    1,
+			nack:   1,
+			ready:  1,
+		},
+		{
+			name:       "foreign entries",
+			push:       []string{"raw", "raw", `{"id":"1"}`},
+			ack:        2,
+			processing: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, address := startFakeRedis(t)
+			queue := openTestRedisQueue(t, address)
+			ctx := context.Background()
+			for _, body := range tt.bodies {
+				if err := queue.Publish(ctx, []byte(body)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, entry := range tt.push {
+				server.do([]string{"LPUSH", "jobs", entry})
+			}
+			want := append(append([]string(nil), tt.bodies...), tt.push...)
+			messages, err := queue.Consume(ctx, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(messages) != len(want) {
+				t.Fatalf("Consume() returned %d messages, want %d", len(messages), len(want))
+			}
+			ids := make(map[string]bool)
+			for i, message := range messages {
+				if string(message.Body) != want[i] {
+					t.Errorf("message %d body = %q, want %q", i, message.Body, want[i])
+				}
+				if ids[message.ID] {
+					t.Errorf("message %d id %q is not unique", i, message.ID)
+				}
+				ids[message.ID] = true
+			}
+			if err = queue.Ack(ctx, messages[:tt.ack]); err != nil {
+				t.Fatal(err)
+			}
+			if err = queue.Nack(ctx, messages[tt.ack:tt.ack+tt.nack]); err != nil {
+				t.Fatal(err)
+			}
+			if got := server.len("jobs"); got != tt.ready {
+				t.Errorf("queue length = %d, want %d", got, tt.ready)
+			}
+			if got := server.len(queue.processing); got != tt.processing {
+				t.Errorf("processing length = %d, want %d", got, tt.processing)
+			}
+		})
+	}
+}
+
+func TestRedisQueueRecover(t *testing.T) {
+	server, address := startFakeRedis(t)
+	queue := openTestRedisQueue(t, address)
+	ctx := context.Background()
+	if err := queue.Publish(ctx, []byte("a"), []byte("b")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := queue.Consume(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	// The consumer with the same name takes over messages left by the
+	// previous one.
+	queue = openTestRedisQueue(t, address)
+	messages, err := queue.Consume(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 2 || string(messages[0].Body) != "b" || string(messages[1].Body) != "a" {
+		t.Errorf("Consume() = %q, want bodies b, a", messages)
+	}
+	if err = queue.Ack(ctx, messages); err != nil {
+		t.Fatal(err)
+	}
+	if got := server.len(queue.processing); got != 0 {
+		t.Errorf("processing length = %d, want 0", got)
+	}
+}
+
+func consumeBodies(t *testing.T, queue *RedisQueue, limit int) (messages []Message, bodies []string) {
+	messages, err := queue.Consume(context.Background(), limit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, message := range messages {
+		bodies = append(bodies, string(message.Body))
+	}
+	return
+}
+
+func TestRedisQueueStream(t *testing.T) {
+	server, address := startFakeRedis(t)
+	rawURL := "redis://" + address + "/jobs?mode=stream"
+	queue := openTestRedisURL(t, rawURL)
+	ctx := context.Background()
+	if err := queue.Publish(ctx, []byte("a"), []byte("b"), []byte("c")); err != nil {
+		t.Fatal(err)
+	}
+	messages, bodies := consumeBodies(t, queue, 2)
+	if !reflect.DeepEqual(bodies, []string{"a", "b"}) {
+		t.Fatalf("Consume() bodies = %q, want a, b", bodies)
+	}
+	if err := queue.Ack(ctx, messages[:1]); err != nil {
+		t.Fatal(err)
+	}
+	if got := server.pending("jobs", "daemons"); got != 1 {
+		t.Errorf("pending = %d after ack, want 1", got)
+	}
+
+	// The consumer restarted after a crash gets its unacknowledged message
+	// once, then the new ones.
+	queue = openTestRedisURL(t, rawURL)
+	tests := [][]string{{"b"}, {"c"}, nil}
+	for i, want := range tests {
+		if messages, bodies = consumeBodies(t, queue, 10); !reflect.DeepEqual(bodies, want) {
+			t.Fatalf("Consume() %d after restart bodies = %q, want %q", i, bodies, want)
+		}
+		if err := queue.Ack(ctx, messages); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := server.pending("jobs", "daemons"); got != 0 {
+		t.Errorf("pending = %d, want 0", got)
+	}
+
+	// Another group of the stream gets all messages.
+	other := openTestRedisURL(t, rawURL+"&group=other")
+	if _, bodies = consumeBodies(t, other, 10); !reflect.DeepEqual(bodies, []string{"a", "b", "c"}) {
+		t.Errorf("Consume() of other group bodies = %q, want a, b, c", bodies)
+	}
+}
+
+func TestRedisQueueStreamPendingPages(t *testing.T) {
+	_, address := startFakeRedis(t)
+	rawURL := "redis://" + address + "/jobs?mode=stream"
+	queue := openTestRedisURL(t, rawURL)
+	if err := queue.Publish(context.Background(), []byte("a"), []byte("b"), []byte("c")); err != nil {
+		t.Fatal(err)
+	}
+	consumeBodies(t, queue, 3)
+	// Pending messages not acknowledged yet are not delivered twice.
+	queue = openTestRedisURL(t, rawURL)
+	var got []string
+	for i := 0; i < 3; i++ {
+		_, bodies := consumeBodies(t, queue, 2)
+		got = append(got, bodies...)
+	}
+	if !reflect.DeepEqual(got, []string{"a", "b", "c"}) {
+		t.Errorf("Consume() bodies = %q, want a, b, c", got)
+	}
+}
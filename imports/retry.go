@@ -0,0 +1,299 @@
+package imports
+
+import (
+	"github.com/phantom-d/go-daemons/config"
+
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// A RetryBatcher is implemented by workers which convert a failed item into
+// a batch for BeforeProcessing and Processing. Without it the item itself is
+// passed as the batch data.
+type RetryBatcher interface {
+	RetryBatch(item interface{}) (interface{}, error)
+}
+
+// A DeadLetter is an item which has exhausted its retries.
+type DeadLetter struct {
+	Worker   string      `json:"worker"`
+	Queue    string      `json:"queue,omitempty"`
+	Item     interface{} `json:"item"`
+	Attempts int         `json:"attempts"`
+	Error    string      `json:"error,omitempty"`
+	Time     time.Time   `json:"time"`
+}
+
+// A DeadLetterSink stores items which have exhausted their retries. Workers
+// implementing it receive dead letters instead of the FileSink.
+type DeadLetterSink interface {
+	DeadLetter(letter DeadLetter) error
+}
+
+// A FileSink appends dead letters to a file as JSON lines.
+type FileSink struct {
+	Path string
+}
+
+func (s *FileSink) DeadLetter(letter DeadLetter) (err error) {
+	var data []byte
+	if data, err = json.Marshal(letter); err != nil {
+		return
+	}
+	var file *os.File
+	if file, err = os.OpenFile(s.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, config.FilePerm); err != nil {
+		return
+	}
+	if _, err = file.Write(append(data, '\n')); err != nil {
+		_ = file.Close()
+		return
+	}
+	return file.Close()
+}
+
+// A retry is a failed item waiting for the next processing attempt. Retries
+// are saved when the worker stops, see config.RetryPolicy.
+type retry struct {
+	item     interface{}
+	attempts int
+	due      time.Time
+	err      string
+	// origin is the batch the item has failed in, it holds the checkpoint.
+	origin int
+}
+
+// next returns the next batch to process: a failed item due for retry or
+// entities returned by GetEntities, unless the worker only retries failed
+// items. Returns nil if there are no entities.
+func next(ctx context.Context, w ContextWorker) (j *job, err error) {
+	wd := w.Data()
+	if r := wd.dueRetry(time.Now()); r != nil {
+		j = &job{data: r.item, retry: r}
+		if message, ok := r.item.(Message); ok {
+			j.data = []Message{message}
+			return
+		}
+		batcher, ok := w.(RetryBatcher)
+		if !ok {
+			batcher, ok = Unwrap(w).(RetryBatcher)
+		}
+		if ok {
+			if j.data, err = batcher.RetryBatch(r.item); err != nil {
+				j.fail(err, "RetryBatch")
+				err = nil
+			}
+		}
+		return
+	}
+	if wd.retryOnly {
+		return
+	}
+	if u, _ := ParseQueue(wd.Queue); u != nil {
+		if j, err = wd.consume(ctx); err != nil || j == nil {
+			return
+		}
+	} else {
+		var data interface{}
+		if data, err = w.GetEntities(ctx); err != nil || data == nil {
+			return
+		}
+		j = &job{data: data}
+	}
+	wd.mu.Lock()
+	j.origin = wd.progress.fetch()
+	wd.mu.Unlock()
+	return
+}
+
+// dueRetry takes the first failed item due for retry at given time.
+func (w *Worker) dueRetry(now time.Time) *retry {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for i, r := range w.retries {
+		if !r.due.After(now) {
+			w.retries = append(w.retries[:i], w.retries[i+1:]...)
+			return r
+		}
+	}
+	return nil
+}
+
+// nextRetry returns the time the next failed item is due for retry, ok is
+// false if there are no failed items.
+func (w *Worker) nextRetry() (due time.Time, ok bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, r := range w.retries {
+		if !ok || r.due.Before(due) {
+			due, ok = r.due, true
+		}
+	}
+	return
+}
+
+// retryFailed schedules retries of the failed items of the completed job.
+// A retried item has failed if the batch made of it has any error items or
+// errors of the hooks.
+func (w *Worker) retryFailed(wi ContextWorker, j *job) {
+	if j.retry == nil && !w.Retry.Enabled() {
+		return
+	}
+	reason := "error item"
+	if len(j.errs) > 0 {
+		reason = j.errs[0].err.Error()
+	}
+	if j.retry != nil {
+		if len(j.batch.ErrorItems) == 0 && len(j.errs) == 0 {
+			w.mu.Lock()
+			w.progress.release(j.retry.origin)
+			w.mu.Unlock()
+			return
+		}
+		j.retry.attempts += 1
+		j.retry.err = reason
+		w.schedule(wi, j.retry)
+		return
+	}
+	for _, item := range j.batch.ErrorItems {
+		w.mu.Lock()
+		w.progress.hold(j.origin)
+		w.mu.Unlock()
+		w.schedule(wi, &retry{item: item, attempts: 1, err: reason, origin: j.origin})
+	}
+}
+
+// schedule queues the failed item for retry after the backoff, or sends it
+// to the dead-letter sink if it has exhausted MaxAttempts.
+func (w *Worker) schedule(wi ContextWorker, r *retry) {
+	if r.attempts >= w.Retry.MaxAttempts {
+		w.deadLetter(wi, r)
+		return
+	}
+	r.due = time.Now().Add(w.Retry.Delay(r.attempts))
+	w.mu.Lock()
+	w.retries = append(w.retries, r)
+	w.metrics.Retries += 1
+	w.mu.Unlock()
+}
+
+func (w *Worker) deadLetter(wi ContextWorker, r *retry) {
+	letter := DeadLetter{
+		Worker:   w.Context.Name,
+		Queue:    redactQueue(w.Queue),
+		Item:     r.item,
+		Attempts: r.attempts,
+		Error:    r.err,
+		Time:     time.Now(),
+	}
+	sink, ok := Unwrap(wi).(DeadLetterSink)
+	if !ok {
+		path := w.Retry.DeadLetter
+		if path == `` {
+			path = w.Context.FileName(".dead.jsonl")
+		}
+		sink = &FileSink{Path: path}
+	}
+	if err := sink.DeadLetter(letter); err != nil {
+		config.Log().Error().Err(err).Msgf("Worker '%s' dead-letter", w.Name)
+	}
+	w.mu.Lock()
+	w.metrics.DeadLetters += 1
+	w.progress.release(r.origin)
+	w.mu.Unlock()
+	config.Log().Warn().Int("attempts", r.attempts).Str("error", r.err).Msgf("Worker '%s' item is dead-lettered", w.Name)
+}
+
+// A savedRetry is a retry saved when the worker stops. A message of the
+// queue is saved as Message, other items as their JSON.
+type savedRetry struct {
+	Item     json.RawMessage `json:"item,omitempty"`
+	Message  *Message        `json:"message,omitempty"`
+	Attempts int             `json:"attempts"`
+	Due      time.Time       `json:"due"`
+	Error    string          `json:"error,omitempty"`
+}
+
+// saveRetries saves failed items still waiting for retry next to the pid
+// file when the worker stops, loadRetries restores them with their attempts
+// on the next start. The batches of the saved items no longer hold the
+// checkpoint. Items which could not be saved are dead-lettered.
+func (w *Worker) saveRetries(wi ContextWorker) {
+	w.mu.Lock()
+	retries := w.retries
+	w.retries = nil
+	w.mu.Unlock()
+	var (
+		kept  []*retry
+		saved []savedRetry
+	)
+	for _, r := range retries {
+		s := savedRetry{Attempts: r.attempts, Due: r.due, Error: r.err}
+		var err error
+		if message, ok := r.item.(Message); ok {
+			s.Message = &message
+		} else {
+			s.Item, err = json.Marshal(r.item)
+		}
+		if err != nil {
+			r.err = fmt.Sprintf("%s (worker stopped: %s)", r.err, err)
+			w.deadLetter(wi, r)
+			continue
+		}
+		kept, saved = append(kept, r), append(saved, s)
+	}
+	fileName := w.Context.FileName(".retries")
+	var err error
+	if len(saved) == 0 {
+		if err = os.Remove(fileName); errors.Is(err, fs.ErrNotExist) {
+			err = nil
+		}
+	} else {
+		err = writeFile(fileName, saved)
+	}
+	if err != nil {
+		config.Log().Error().Err(err).Msgf("Worker '%s' save retries", w.Name)
+		for _, r := range kept {
+			r.err = fmt.Sprintf("%s (worker stopped)", r.err)
+			w.deadLetter(wi, r)
+		}
+		return
+	}
+	w.mu.Lock()
+	for _, r := range kept {
+		w.progress.release(r.origin)
+	}
+	w.mu.Unlock()
+	w.advanceCheckpoint(wi)
+}
+
+// loadRetries restores the retries saved when the worker stopped. Items
+// other than messages of the queue are restored as json.RawMessage, they
+// are decoded by the RetryBatcher, see PipelineWorker. The file is kept
+// until the worker stops again, so the items are retried once more after
+// a crash.
+func (w *Worker) loadRetries() {
+	var saved []savedRetry
+	ok, err := readFile(w.Context.FileName(".retries"), &saved)
+	if err != nil {
+		config.Log().Error().Err(err).Msgf("Worker '%s' load retries", w.Name)
+	}
+	if !ok {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, s := range saved {
+		// The checkpoint is not held, it has passed the batch of the item.
+		r := &retry{item: s.Item, attempts: s.Attempts, due: s.Due, err: s.Error, origin: -1}
+		if s.Message != nil {
+			r.item = *s.Message
+		}
+		w.retries = append(w.retries, r)
+	}
+	config.Log().Info().Int("retries", len(saved)).Msgf("Worker '%s' restores retries", w.Name)
+}
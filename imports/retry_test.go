@@ -0,0 +1,133 @@
+package imports
+
+import (
+	"github.com/phantom-d/go-daemons/config"
+
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testSinkWorker struct {
+	testContextWorker
+	letters []DeadLetter
+}
+
+func (w *testSinkWorker) DeadLetter(letter DeadLetter) error {
+	w.letters = append(w.letters, letter)
+	return nil
+}
+
+func newTestRetryWorker(maxAttempts int) *testSinkWorker {
+	w := &testSinkWorker{}
+	w.Worker = Worker{
+		Name:    "test",
+		Retry:   config.RetryPolicy{MaxAttempts: maxAttempts},
+		Context: &config.Context{Name: "test"},
+		mu:      &sync.Mutex{},
+	}
+	return w
+}
+
+func TestRetryFailed(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxAttempts int
+		// fails tells whether every attempt of the item fails, the first
+		// one is the processing of the fetched batch.
+		fails    []bool
+		retries  uint64
+		attempts int
+	}{
+		{name: "retries disabled", fails: []bool{true}},
+		{name: "succeeded on retry", maxAttempts: 3, fails: []bool{true, false}, retries: 1},
+		{name: "dead-lettered", maxAttempts: 3, fails: []bool{true, true, true}, retries: 2, attempts: 3},
+		{name: "single attempt", maxAttempts: 1, fails: []bool{true}, attempts: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := newTestRetryWorker(tt.maxAttempts)
+			wd := w.Data()
+			j := &job{origin: wd.progress.fetch(), batch: ResultProcess{ErrorItems: []interface{}{"item"}}}
+			wd.retryFailed(w, j)
+			wd.progress.complete(j.origin, []string{"1"})
+			for i, fails := range tt.fails[1:] {
+				r := wd.dueRetry(time.Now().Add(time.Hour))
+				if r == nil {
+					t.Fatalf("attempt %d: no retry is due", i+2)
+				}
+				j = &job{retry: r}
+				if fails {
+					j.batch.ErrorItems = []interface{}{r.item}
+				}
+				wd.retryFailed(w, j)
+			}
+			if r := wd.dueRetry(time.Now().Add(time.Hour)); r != nil {
+				t.Errorf("retry of attempt %d is left", r.attempts)
+			}
+			if wd.metrics.Retries != tt.retries {
+				t.Errorf("retries = %d, want %d", wd.metrics.Retries, tt.retries)
+			}
+			switch {
+			case tt.attempts == 0 && len(w.letters) > 0:
+				t.Errorf("dead letters = %v, want none", w.letters)
+			case tt.attempts > 0 && (len(w.letters) != 1 || w.letters[0].Attempts != tt.attempts):
+				t.Errorf("dead letters = %v, want one after %d attempts", w.letters, tt.attempts)
+			}
+			if ids, _ := wd.progress.advance(); len(ids) != 1 {
+				t.Errorf("checkpoint is held back after the item is settled")
+			}
+		})
+	}
+}
+
+func TestRetryHoldsCheckpoint(t *testing.T) {
+	w := newTestRetryWorker(3)
+	wd := w.Data()
+	j := &job{origin: wd.progress.fetch(), batch: ResultProcess{ErrorItems: []interface{}{"item"}}}
+	wd.retryFailed(w, j)
+	wd.progress.complete(j.origin, []string{"1"})
+	if ids, _ := wd.progress.advance(); ids != nil {
+		t.Errorf("advance() = %v while the item waits for retry, want nil", ids)
+	}
+}
+
+func TestSaveRetries(t *testing.T) {
+	pidFileName := filepath.Join(t.TempDir(), "test.pid")
+	w := newTestRetryWorker(3)
+	wd := w.Data()
+	wd.Context.PidFileName = pidFileName
+	message := Message{ID: "1", Body: []byte("b")}
+	j := &job{origin: wd.progress.fetch(), batch: ResultProcess{ErrorItems: []interface{}{"a", message, make(chan int)}}}
+	wd.retryFailed(w, j)
+	wd.progress.complete(j.origin, []string{"1"})
+	wd.saveRetries(w)
+	if len(w.letters) != 1 || !strings.Contains(w.letters[0].Error, "(worker stopped: ") {
+		t.Errorf("dead letters = %v, want the item failed to be saved", w.letters)
+	}
+	if _, ok := wd.nextRetry(); ok {
+		t.Error("retries are left after the stop")
+	}
+	if wd.LastCheckpoint() == nil {
+		t.Error("checkpoint is held back by the saved items")
+	}
+
+	restarted := newTestRetryWorker(3)
+	wd = restarted.Data()
+	wd.Context.PidFileName = pidFileName
+	wd.loadRetries()
+	var items []interface{}
+	for r := wd.dueRetry(time.Now().Add(time.Hour)); r != nil; r = wd.dueRetry(time.Now().Add(time.Hour)) {
+		if r.attempts != 1 {
+			t.Errorf("attempts = %d, want 1", r.attempts)
+		}
+		items = append(items, r.item)
+	}
+	if want := []interface{}{json.RawMessage(`"a"`), message}; !reflect.DeepEqual(items, want) {
+		t.Errorf("restored items = %v, want %v", items, want)
+	}
+}
@@ -0,0 +1,147 @@
+package imports
+
+import (
+	"github.com/phantom-d/go-daemons/config"
+	"github.com/phantom-d/go-daemons/metrics"
+
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// A Summary describes the last run of the worker. The worker process saves
+// it next to its pid file after every run.
+type Summary struct {
+	Time      time.Time     `json:"time"`
+	Queue     string        `json:"queue,omitempty"`
+	Total     int           `json:"total"`
+	Errors    int           `json:"errors"`
+	Duration  time.Duration `json:"duration"`
+	Memory    uint64        `json:"memory"`
+	LastError string        `json:"last_error,omitempty"`
+	// Retrying is the number of failed items waiting for retry.
+	Retrying int `json:"retrying,omitempty"`
+	// DeadLetters is the number of items sent to the dead-letter sink since
+	// the worker has started.
+	DeadLetters uint64 `json:"dead_letters,omitempty"`
+}
+
+func (w *Worker) saveSummary(result *ResultProcess, runErr error) (err error) {
+	summary := Summary{
+		Time:        time.Now(),
+		Queue:       redactQueue(result.Queue),
+		Total:       result.Total,
+		Errors:      len(result.ErrorItems),
+		Duration:    result.Duration,
+		Memory:      result.Memory,
+		Retrying:    len(w.retries),
+		DeadLetters: w.metrics.DeadLetters,
+	}
+	if runErr != nil {
+		summary.LastError = runErr.Error()
+	}
+	return writeFile(w.Context.FileName(".result"), summary)
+}
+
+// Metrics are cumulative counters of the worker process, Errors counts errors
+// returned by the worker hooks, MemoryBreaches counts runs and batches
+// skipped over the memory limit, Retries counts scheduled retries of failed
+// items and DeadLetters counts items which have exhausted their retries.
+// Duration observes durations of the runs, BatchDuration of the processing
+// of every batch. The worker process saves them next to its pid file after
+// every run, the counters are reset when it is restarted.
+type Metrics struct {
+	Runs           uint64             `json:"runs"`
+	Items          uint64             `json:"items"`
+	ErrorItems     uint64             `json:"error_items"`
+	Errors         uint64             `json:"errors"`
+	MemoryBreaches uint64             `json:"memory_breaches"`
+	Retries        uint64             `json:"retries"`
+	DeadLetters    uint64             `json:"dead_letters"`
+	RetryPending   int                `json:"retry_pending"`
+	Duration       *metrics.Histogram `json:"duration"`
+	BatchDuration  *metrics.Histogram `json:"batch_duration"`
+	Memory         uint64             `json:"memory"`
+	TickLag        time.Duration      `json:"tick_lag"`
+}
+
+// observe adds the run result to the metrics of the worker, result is nil
+// if the run was skipped.
+func (w *Worker) observe(result *ResultProcess, lag time.Duration) {
+	if w.metrics.Duration == nil {
+		w.metrics.Duration = metrics.NewHistogram()
+	}
+	w.metrics.TickLag = lag
+	w.metrics.RetryPending = len(w.retries)
+	if result == nil {
+		return
+	}
+	w.metrics.Runs += 1
+	w.metrics.Items += uint64(result.Total)
+	w.metrics.ErrorItems += uint64(len(result.ErrorItems))
+	w.metrics.Duration.Observe(result.Duration.Seconds())
+	w.metrics.Memory = result.Memory
+}
+
+// observeBatch adds the duration of the processed batch to the metrics of
+// the worker.
+func (w *Worker) observeBatch(duration time.Duration) {
+	if w.metrics.BatchDuration == nil {
+		w.metrics.BatchDuration = metrics.NewHistogram()
+	}
+	w.metrics.BatchDuration.Observe(duration.Seconds())
+}
+
+func (w *Worker) saveMetrics() error {
+	return writeFile(w.Context.FileName(".metrics"), w.metrics)
+}
+
+// LoadMetrics reads metrics saved by the worker process with given context.
+// Returns nil if the worker has not saved any metrics.
+func LoadMetrics(ctx *config.Context) (result *Metrics, err error) {
+	result = &Metrics{}
+	if ok, err := readFile(ctx.FileName(".metrics"), result); !ok {
+		return nil, err
+	}
+	return
+}
+
+// LoadSummary reads the summary of the last run saved by the worker process
+// with given context. Returns nil if the worker has not finished any run.
+func LoadSummary(ctx *config.Context) (summary *Summary, err error) {
+	summary = &Summary{}
+	if ok, err := readFile(ctx.FileName(".result"), summary); !ok {
+		return nil, err
+	}
+	return
+}
+
+// writeFile saves value as JSON, the file is replaced atomically.
+func writeFile(fileName string, value interface{}) (err error) {
+	var data []byte
+	if data, err = json.Marshal(value); err != nil {
+		return
+	}
+	if err = os.WriteFile(fileName+".tmp", data, config.FilePerm); err != nil {
+		return
+	}
+	return os.Rename(fileName+".tmp", fileName)
+}
+
+// readFile loads JSON value from the file, ok is false if the file does not
+// exist or is invalid.
+func readFile(fileName string, value interface{}) (ok bool, err error) {
+	var data []byte
+	if data, err = os.ReadFile(fileName); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			err = nil
+		}
+		return
+	}
+	if err = json.Unmarshal(data, value); err != nil {
+		return
+	}
+	return true, nil
+}
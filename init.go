@@ -3,6 +3,7 @@ package daemons
 import (
 	"context"
 	"github.com/phantom-d/go-daemons/config"
+	"github.com/phantom-d/go-daemons/metrics"
 	"os"
 	"time"
 )
@@ -15,22 +16,29 @@ type DaemonInterface interface {
 }
 
 type DaemonData struct {
-	Name        string                 `mapstructure:"Name"`
-	MemoryLimit uint64                 `mapstructure:"MemoryLimit"`
-	Workers     []config.Worker        `mapstructure:"Workers"`
-	Params      map[string]interface{} `mapstructure:"Params"`
-	Sleep       time.Duration          `mapstructure:"Sleep"`
-	Context     *config.Context
-	ctx         context.Context
-	signalChan  chan os.Signal
-	done        chan struct{}
-}
-
-type DaemonStatus struct {
-	Count struct {
-		Current int8 `json:"current"`
-		Total   int8 `json:"total"`
-	} `json:"count"`
+	Name            string                 `mapstructure:"Name"`
+	MemoryLimit     uint64                 `mapstructure:"MemoryLimit"`
+	MemoryAction    string                 `mapstructure:"MemoryAction"`
+	MemoryCgroup    bool                   `mapstructure:"MemoryCgroup"`
+	Resources       config.Resources       `mapstructure:"Resources"`
+	Workers         []config.Worker        `mapstructure:"Workers"`
+	Params          map[string]interface{} `mapstructure:"Params"`
+	Sleep           time.Duration          `mapstructure:"Sleep"`
+	Restart         config.RestartPolicy   `mapstructure:"Restart"`
+	ShutdownTimeout time.Duration          `mapstructure:"ShutdownTimeout"`
+	Health          config.HealthCheck     `mapstructure:"Health"`
+	Schedule        string                 `mapstructure:"Schedule"`
+	Timezone        string                 `mapstructure:"Timezone"`
+	Context         *config.Context
+	ctx             context.Context
+	signalChan      chan os.Signal
+	exits           chan config.ExitEvent
+	children        map[string]*config.Context
+	restarts        map[string]*RestartState
+	controls        chan controlCall
+	collects        chan chan *metrics.Set
+	health          *config.Health
+	done            chan struct{}
 }
 
 type FactoryData map[string]func() DaemonInterface
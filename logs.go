@@ -0,0 +1,189 @@
+package daemons
+
+import (
+	"github.com/phantom-d/go-daemons/config"
+	"github.com/phantom-d/go-daemons/imports"
+
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// CommandLogs shows the log files of a daemon or a worker. It is handled by
+// the command line process, the watcher need not be running.
+const CommandLogs = "logs"
+
+// followInterval is the period of checks of the followed log files.
+const followInterval = 500 * time.Millisecond
+
+// Logs writes the last lines of the log files of the target to w: a daemon,
+// "<daemon>/<worker>" or a worker name unique among daemons, files of every
+// replica of the worker are shown. The number of lines is given by the
+// "--lines" flag, 10 by default. With the "--follow" flag the files are
+// followed until the process is interrupted, also across rotations.
+func Logs(w io.Writer, target string) (err error) {
+	if target == `` {
+		return errors.New("usage: -s logs <worker> [-f]")
+	}
+	var paths []string
+	if paths, err = logPaths(target); err != nil {
+		return
+	}
+	lines := config.Cfg().Lines
+	if lines <= 0 {
+		lines = 10
+	}
+	logs := make([]*followedLog, 0, len(paths))
+	for _, path := range paths {
+		log := &followedLog{path: path}
+		if err = log.tail(lines); err != nil {
+			return
+		}
+		logs = append(logs, log)
+	}
+	var last *followedLog
+	for {
+		for _, log := range logs {
+			if len(log.data) == 0 {
+				continue
+			}
+			if len(logs) > 1 && log != last {
+				if _, err = fmt.Fprintf(w, "==> %s <==\n", log.path); err != nil {
+					return
+				}
+				last = log
+			}
+			if _, err = w.Write(log.data); err != nil {
+				return
+			}
+			log.data = nil
+		}
+		if !config.Cfg().Follow {
+			return
+		}
+		time.Sleep(followInterval)
+		for _, log := range logs {
+			if err = log.follow(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// logPaths returns the log files of the target.
+func logPaths(target string) (paths []string, err error) {
+	if config.Cfg().LogFile == `` {
+		return nil, errors.New("LogFile is not configured")
+	}
+	if daemonName, workerName := splitTarget(target); workerName == `` {
+		if _, ok := config.Cfg().Daemons[daemonName]; ok {
+			return []string{config.Cfg().LogPath(daemonName, ``)}, nil
+		}
+	}
+	var (
+		cfg    config.Worker
+		parent string
+	)
+	if cfg, parent, err = targetWorker(target); err != nil {
+		return
+	}
+	for replica := 0; replica < imports.ReplicaCount(cfg); replica++ {
+		paths = append(paths, config.Cfg().LogPath(parent, imports.ReplicaName(cfg, replica)))
+	}
+	return
+}
+
+// A followedLog is a log file read by Logs, data is read and not written
+// yet.
+type followedLog struct {
+	path   string
+	file   *os.File
+	offset int64
+	data   []byte
+}
+
+// tail opens the file and reads its last lines. A file which does not exist
+// yet is opened by follow.
+func (log *followedLog) tail(lines int) (err error) {
+	if log.file, err = os.Open(log.path); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			err = nil
+		}
+		return
+	}
+	var info os.FileInfo
+	if info, err = log.file.Stat(); err != nil {
+		return
+	}
+	// The file is read backwards by chunks until enough lines are found.
+	const chunk = 64 << 10
+	size := info.Size()
+	start := size
+	var data []byte
+	for start > 0 && bytes.Count(data, []byte("\n")) <= lines {
+		n := int64(chunk)
+		if n > start {
+			n = start
+		}
+		start -= n
+		buf := make([]byte, n)
+		if _, err = log.file.ReadAt(buf, start); err != nil {
+			return
+		}
+		data = append(buf, data...)
+	}
+	for count := bytes.Count(data, []byte("\n")); count > lines || count == lines && !bytes.HasSuffix(data, []byte("\n")); count-- {
+		data = data[bytes.IndexByte(data, '\n')+1:]
+	}
+	log.data, log.offset = data, size
+	return
+}
+
+// follow reads data appended to the file. A rotated or truncated file is
+// read again from the beginning after the rest of the previous one.
+func (log *followedLog) follow() (err error) {
+	if log.file != nil {
+		if err = log.read(); err != nil {
+			return
+		}
+	}
+	info, err := os.Stat(log.path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			err = nil
+		}
+		return
+	}
+	if log.file != nil {
+		var current os.FileInfo
+		if current, err = log.file.Stat(); err != nil {
+			return
+		}
+		if os.SameFile(info, current) && info.Size() >= log.offset {
+			return
+		}
+		_ = log.file.Close()
+	}
+	if log.file, err = os.Open(log.path); err != nil {
+		return
+	}
+	log.offset = 0
+	return log.read()
+}
+
+func (log *followedLog) read() (err error) {
+	var data []byte
+	if _, err = log.file.Seek(log.offset, io.SeekStart); err != nil {
+		return
+	}
+	if data, err = io.ReadAll(log.file); err != nil {
+		return
+	}
+	log.data = append(log.data, data...)
+	log.offset += int64(len(data))
+	return
+}
@@ -0,0 +1,75 @@
+package daemons
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFollowedLogTail(t *testing.T) {
+	long := strings.Repeat("x", 100<<10)
+	tests := []struct {
+		name  string
+		data  string
+		lines int
+		want  string
+	}{
+		{name: "fewer lines", data: "a\nb\n", lines: 10, want: "a\nb\n"},
+		{name: "exact lines", data: "a\nb\n", lines: 2, want: "a\nb\n"},
+		{name: "last lines", data: "a\nb\nc\n", lines: 2, want: "b\nc\n"},
+		{name: "unterminated last line", data: "a\nb\nc", lines: 2, want: "b\nc"},
+		{name: "no newline", data: "abc", lines: 1, want: "abc"},
+		{name: "empty", data: "", lines: 1, want: ""},
+		{name: "lines longer than a chunk", data: long + "\n" + long + "\nend\n", lines: 2, want: long + "\nend\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "app.log")
+			if err := os.WriteFile(path, []byte(tt.data), 0600); err != nil {
+				t.Fatal(err)
+			}
+			log := &followedLog{path: path}
+			if err := log.tail(tt.lines); err != nil {
+				t.Fatal(err)
+			}
+			defer log.file.Close()
+			if string(log.data) != tt.want {
+				t.Errorf("tail(%d) = %.40q, want %.40q", tt.lines, log.data, tt.want)
+			}
+			if log.offset != int64(len(tt.data)) {
+				t.Errorf("offset = %d, want %d", log.offset, len(tt.data))
+			}
+		})
+	}
+}
+
+func TestFollowedLogRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	if err := os.WriteFile(path, []byte("a\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	log := &followedLog{path: path}
+	if err := log.tail(10); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = log.file.Close() }()
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = file.WriteString("b\n")
+	_ = file.Close()
+	if err = os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(path, []byte("c\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = log.follow(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(log.data), "a\nb\nc\n"; got != want {
+		t.Errorf("data = %q, want %q", got, want)
+	}
+}
@@ -2,12 +2,11 @@ package daemons
 
 import (
 	"github.com/phantom-d/go-daemons/config"
-	"github.com/phantom-d/go-daemons/imports"
+	"github.com/phantom-d/go-daemons/metrics"
 
 	"github.com/mitchellh/mapstructure"
 
 	"context"
-	"encoding/json"
 	"fmt"
 	"os"
 	"os/signal"
@@ -22,6 +21,10 @@ func New(name string) DaemonInterface {
 		if cfg.Enabled {
 			cfg.Name = name
 			d := Factory.CreateInstance(name)
+			if d == nil {
+				config.Log().Error().Msgf("Daemon '%s' is not registered!", name)
+				return nil
+			}
 			dd := &DaemonData{}
 			err := mapstructure.Decode(cfg, &dd)
 			if err != nil {
@@ -49,6 +52,12 @@ func New(name string) DaemonInterface {
 			if notExists {
 				args = append(args, daemonArg)
 			}
+			if dd.ShutdownTimeout <= 0 {
+				dd.ShutdownTimeout = config.DefaultShutdownTimeout
+			}
+			if dd.MemoryAction == `` {
+				dd.MemoryAction = config.MemoryRestart
+			}
 			dd.Context = &config.Context{
 				Name:        name,
 				Type:        `daemon`,
@@ -57,6 +66,10 @@ func New(name string) DaemonInterface {
 				WorkDir:     "./",
 				Args:        args,
 			}
+			dd.Context.Resources = dd.Resources
+			if dd.MemoryCgroup && dd.Resources.MemoryMax == 0 {
+				dd.Context.Resources.MemoryMax = dd.MemoryLimit
+			}
 			d.SetData(dd)
 			return d
 		} else {
@@ -68,51 +81,150 @@ func New(name string) DaemonInterface {
 	return nil
 }
 
-// Start daemon
+// Start daemon. On SIGINT, SIGTERM or SIGQUIT the daemon stops running new
+// iterations, terminates its children and returns nil, so the caller can
+// exit with status 0. A second signal terminates the process immediately.
+// On SIGHUP the configuration files are reloaded and applied to the daemon.
+// On SIGUSR1 the log file is reopened, the signal is passed to the children.
+// Daemons implementing Controller and Collector also serve the control
+// socket and the metrics endpoint, health checks are served if configured.
+// With --once the daemon starts its children once and returns ExitError
+// describing their results.
 func Start(d DaemonInterface) (err error) {
 	var (
 		cancel context.CancelFunc
 	)
-	dd := *d.Data()
+	dd := d.Data()
+	if err = config.OpenLog(dd.Name, ``); err != nil {
+		return
+	}
 	config.Log().Info().Msgf("Start daemon '%s'!", dd.Name)
+	timer, err := config.NewTimer(dd.Schedule, dd.Timezone, dd.Sleep)
+	if err != nil {
+		return
+	}
 	err = dd.Context.CreatePidFile()
 	if err != nil {
 		return
 	}
 	dd.ctx, cancel = context.WithCancel(context.Background())
 	dd.signalChan = make(chan os.Signal, 1)
-	signal.Notify(dd.signalChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+	dd.exits = make(chan config.ExitEvent, len(dd.Workers)+1)
+	dd.done = make(chan struct{})
+	stopped := make(chan os.Signal, 1)
+	reloads := make(chan struct{}, 1)
+	reopens := make(chan struct{}, 1)
+	signal.Notify(dd.signalChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT, syscall.SIGHUP, syscall.SIGUSR1)
 
 	defer func() {
 		signal.Stop(dd.signalChan)
 		cancel()
+		close(dd.done)
 	}()
 
+	controller, isController := d.(Controller)
+	if isController {
+		var closeControl func()
+		if closeControl, err = dd.listenControl(); err != nil {
+			config.Log().Error().Err(err).Msgf("Daemon '%s' control socket", dd.Name)
+			err = nil
+		} else {
+			defer closeControl()
+		}
+	}
+
+	collector, isCollector := d.(Collector)
+	if isCollector && config.Cfg().Metrics != `` {
+		var closeMetrics func()
+		if closeMetrics, err = dd.serveMetrics(config.Cfg().Metrics); err != nil {
+			config.Log().Error().Err(err).Msgf("Daemon '%s' metrics endpoint", dd.Name)
+			err = nil
+		} else {
+			defer closeMetrics()
+		}
+	}
+
+	defer dd.serveHealth()()
+	dd.heartbeat(d)
+	var keepalive <-chan time.Time
+	if dd.health != nil {
+		keepalive = time.Tick(dd.health.Interval())
+	}
+	next := timer.C()
+
 	go func() {
 		for {
 			select {
 			case s := <-dd.signalChan:
 				switch s {
 				case syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT:
+					if dd.ctx.Err() != nil {
+						config.Log().Warn().Msgf("daemon '%s' forced to exit", dd.Name)
+						os.Exit(1)
+					}
 					config.Log().Info().Msgf("daemon '%s' terminate", dd.Name)
-					d.Terminate(s)
+					stopped <- s
 					cancel()
-					os.Exit(1)
+				case syscall.SIGHUP:
+					select {
+					case reloads <- struct{}{}:
+					default:
+					}
+				case syscall.SIGUSR1:
+					select {
+					case reopens <- struct{}{}:
+					default:
+					}
 				}
-			case <-dd.ctx.Done():
-				config.Log().Info().Msgf("daemon '%s' is done", dd.Name)
-				os.Exit(1)
+			case <-dd.done:
+				return
 			}
 		}
 	}()
+	if config.Cfg().Once {
+		return dd.once(d, stopped, keepalive)
+	}
 	for {
 		select {
 		case <-dd.ctx.Done():
+			if dd.health != nil {
+				dd.health.Stopping()
+			}
+			d.Terminate(config.StopSignal(stopped))
+			config.Log().Info().Msgf("daemon '%s' is done", dd.Name)
 			return
-		case <-time.Tick(dd.Sleep):
+		case <-reopens:
+			dd.signalChildren(syscall.SIGUSR1)
+		case <-reloads:
+			reload(d)
+			if reloaded, err := config.NewTimer(dd.Schedule, dd.Timezone, dd.Sleep); err != nil {
+				config.Log().Error().Err(err).Msgf("Reload daemon '%s' schedule", dd.Name)
+			} else {
+				timer = reloaded
+			}
+			next = timer.C()
+			if err = d.Run(); err != nil {
+				return
+			}
+		case call := <-dd.controls:
+			call.reply <- control(controller, call.request)
+		case reply := <-dd.collects:
+			set := metrics.NewSet()
+			collector.Collect(set)
+			reply <- set
+		case event := <-dd.exits:
+			exited(event)
+			if err = d.Run(); err != nil {
+				return
+			}
+		case <-keepalive:
+			dd.health.Tick()
+		case <-next:
+			dd.heartbeat(d)
 			if err = d.Run(); err != nil {
 				return
 			}
+			next = timer.C()
 		}
 	}
 }
@@ -123,67 +235,25 @@ func Exec(d DaemonInterface) (err error) {
 	return
 }
 
-func DaemonsStatus(name string) (result []byte, err error) {
-	daemonsStatus := make(map[string]DaemonStatus)
-	if name == `` {
-		name = `watcher`
-	}
-	if name != "" {
-		if daemon := New(name); daemon != nil {
-			if daemon.Data().Name == `watcher` {
-				for _, cfg := range daemon.Data().Workers {
-					if worker := New(cfg.Name); worker != nil {
-						if daemonStatus, err := worker.Data().getWorkersStatus(); err == nil {
-							daemonsStatus[cfg.Name] = daemonStatus
-						}
-					}
-				}
-			} else {
-				if daemonStatus, err := daemon.Data().getWorkersStatus(); err == nil {
-					daemonsStatus[name] = daemonStatus
-				}
-			}
-		}
-	}
-	result, err = json.Marshal(daemonsStatus)
-	return
-}
-
 func (dd *DaemonData) Data() *DaemonData {
 	return dd
 }
 
 func (dd *DaemonData) Terminate(s os.Signal) {
+	var children []childProcess
+	var names []string
 	for _, cfg := range dd.Workers {
 		if daemon := New(cfg.Name); daemon != nil {
-			dm, err := daemon.Data().Context.Search()
-			config.Log().Debug().Msgf("Terminate daemon dm: '%+v'", dm)
-			config.Log().Debug().Msgf("Terminate daemon Context: '%+v'", daemon.Data().Context)
-			if err == nil {
-				if err := dm.Signal(s); err != nil {
-					config.Log().Error().Err(err).Msgf("Terminate daemon '%s'", cfg.Name)
-				}
-			} else {
-				config.Log().Error().Err(err).Msgf("Terminate daemon '%s'", cfg.Name)
+			if child, ok := dd.child(cfg.Name, daemon.Data().Context); ok {
+				children = append(children, child)
+				names = append(names, cfg.Name)
 			}
 		}
 	}
+	terminate(children, s, dd.ShutdownTimeout)
+	dd.stopped(names)
 	err := dd.Context.Release()
 	if err != nil {
 		config.Log().Error().Err(err).Msgf("Daemon '%s' terminate", dd.Name)
 	}
 }
-
-func (dd *DaemonData) getWorkersStatus() (result DaemonStatus, err error) {
-	var status bool
-	result = DaemonStatus{}
-	for _, cfg := range dd.Workers {
-		if worker := imports.New(cfg, dd.Name, dd.Params); worker != nil {
-			result.Count.Total += 1
-			if status, err = worker.GetStatus(); status {
-				result.Count.Current += 1
-			}
-		}
-	}
-	return
-}
@@ -0,0 +1,49 @@
+package daemons
+
+import (
+	"github.com/phantom-d/go-daemons/config"
+
+	"fmt"
+	"syscall"
+	"time"
+)
+
+// checkMemory applies the memory action to the running child exceeding its
+// memory limit, zero limit means no limit. The child is stopped gracefully
+// or killed and started again by the next run regardless of its restart
+// policy. The breach is logged and kept in the restart state for the status.
+func (dd *DaemonData) checkMemory(name string, ctx *config.Context, rs *RestartState, limit uint64, action string) {
+	if limit == 0 || action == config.MemorySkip || rs.State == StateBackoff {
+		return
+	}
+	child, ok := dd.child(name, ctx)
+	if !ok {
+		return
+	}
+	rss, err := config.ProcessMemory(child.process.Pid)
+	if err != nil || rss <= limit {
+		return
+	}
+	config.Log().Warn().
+		Str("name", name).
+		Str("type", ctx.Type).
+		Int("pid", child.process.Pid).
+		Uint64("rss", rss).
+		Uint64("limit", limit).
+		Str("action", action).
+		Msgf("Memory limit of %s '%s' exceeded", ctx.Type, name)
+	emit(&MemoryExceeded{EventSource: newSource(name, ctx, child.process.Pid), RSS: rss, Limit: limit, Action: action})
+	emit(&Restarting{EventSource: newSource(name, ctx, child.process.Pid), Restarts: rs.Restarts + 1})
+	rs.State, rs.NextStart = StateBackoff, time.Now()
+	rs.Error = fmt.Sprintf("memory limit exceeded: rss %d > %d", rss, limit)
+	if err = rs.Save(); err != nil {
+		config.Log().Error().Err(err).Msgf("Save restart state '%s'", rs.Name)
+	}
+	if action == config.MemoryKill {
+		if err = child.process.Kill(); err != nil {
+			config.Log().Error().Err(err).Msgf("Kill %s '%s'", ctx.Type, name)
+		}
+		return
+	}
+	go terminate([]childProcess{child}, syscall.SIGTERM, dd.ShutdownTimeout)
+}
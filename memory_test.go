@@ -0,0 +1,58 @@
+package daemons
+
+import (
+	"github.com/phantom-d/go-daemons/config"
+
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckMemory(t *testing.T) {
+	tests := []struct {
+		name   string
+		limit  uint64
+		action string
+		state  string
+		// signal terminated the child, empty if it is running.
+		signal string
+	}{
+		{name: "no limit", action: config.MemoryKill, state: StateRunning},
+		{name: "skip", limit: 1, action: config.MemorySkip, state: StateRunning},
+		{name: "under limit", limit: 1 << 40, action: config.MemoryKill, state: StateRunning},
+		{name: "kill", limit: 1, action: config.MemoryKill, state: StateBackoff, signal: "killed"},
+		{name: "restart", limit: 1, action: config.MemoryRestart, state: StateBackoff, signal: "terminated"},
+	}
+	defer func(cfg config.Config) { *config.Cfg() = cfg }(*config.Cfg())
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.Cfg().PidDir = t.TempDir()
+			dd := &DaemonData{ShutdownTimeout: time.Second}
+			ctx := startChild(t, dd, "w", "sleep 10")
+			defer func() { _ = ctx.Cmd().Process.Kill() }()
+			rs := dd.restartState("import_w")
+			rs.Start(time.Now())
+			dd.checkMemory("w", ctx, rs, tt.limit, tt.action)
+			if rs.State != tt.state {
+				t.Errorf("state = %q, want %q", rs.State, tt.state)
+			}
+			if tt.signal == `` {
+				if !ctx.Running() {
+					t.Error("the child under the limit is stopped")
+				}
+				return
+			}
+			if !strings.HasPrefix(rs.Error, "memory limit exceeded") {
+				t.Errorf("restart state error = %q, want the breach", rs.Error)
+			}
+			select {
+			case <-ctx.Done():
+			case <-time.After(5 * time.Second):
+				t.Fatal("the child over the limit is running")
+			}
+			if exit := ctx.Exit(); exit.Signal != tt.signal {
+				t.Errorf("exit signal = %q, want %q", exit.Signal, tt.signal)
+			}
+		})
+	}
+}
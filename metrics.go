@@ -0,0 +1,112 @@
+package daemons
+
+import (
+	"github.com/phantom-d/go-daemons/config"
+	"github.com/phantom-d/go-daemons/imports"
+	"github.com/phantom-d/go-daemons/metrics"
+
+	"errors"
+	"net"
+	"net/http"
+	"time"
+)
+
+// A Collector adds metrics of the daemon and its children to the set.
+// Start serves the metrics endpoint for daemons implementing Collector if
+// the metrics listen address is configured, metrics are collected in the
+// daemon loop between runs.
+type Collector interface {
+	Collect(set *metrics.Set)
+}
+
+// serveMetrics serves "/metrics" on the address until the returned close
+// function is called.
+func (dd *DaemonData) serveMetrics(address string) (closeMetrics func(), err error) {
+	var listener net.Listener
+	if listener, err = net.Listen("tcp", address); err != nil {
+		return
+	}
+	dd.collects = make(chan chan *metrics.Set)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", dd.metricsHandler)
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: ControlTimeout}
+	config.Log().Info().Msgf("Daemon '%s' serve metrics on '%s'", dd.Name, listener.Addr())
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			config.Log().Error().Err(err).Msgf("Daemon '%s' metrics endpoint", dd.Name)
+		}
+	}()
+	closeMetrics = func() {
+		_ = server.Close()
+	}
+	return
+}
+
+func (dd *DaemonData) metricsHandler(w http.ResponseWriter, r *http.Request) {
+	reply := make(chan *metrics.Set, 1)
+	select {
+	case dd.collects <- reply:
+	case <-dd.done:
+		http.Error(w, "daemon is stopping", http.StatusServiceUnavailable)
+		return
+	case <-time.After(ControlTimeout):
+		http.Error(w, "daemon is busy", http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if _, err := (<-reply).WriteTo(w); err != nil {
+		config.Log().Error().Err(err).Msgf("Daemon '%s' metrics endpoint", dd.Name)
+	}
+}
+
+// Collect adds state of the supervised daemons and their workers, and
+// counters saved by the worker processes.
+func (watcher *Watcher) Collect(set *metrics.Set) {
+	statuses, err := Status(watcher.Name)
+	if err != nil {
+		config.Log().Error().Err(err).Msgf("Daemon '%s' collect metrics", watcher.Name)
+		return
+	}
+	for name, status := range statuses {
+		labels := metrics.Labels{"daemon": name}
+		set.Gauge("daemons_up", "Whether the daemon is running.", labels, up(status.State))
+		set.Counter("daemons_restarts_total", "Number of daemon restarts.", labels, float64(status.Restarts))
+		set.Gauge("daemons_memory_rss_bytes", "Resident memory of the daemon process.", labels, float64(status.Memory))
+		for _, worker := range status.Workers {
+			labels := metrics.Labels{"daemon": name, "worker": worker.Name}
+			set.Gauge("daemons_worker_up", "Whether the worker is running.", labels, up(worker.State))
+			set.Counter("daemons_worker_restarts_total", "Number of worker restarts.", labels, float64(worker.Restarts))
+			set.Gauge("daemons_worker_memory_rss_bytes", "Resident memory of the worker process.", labels, float64(worker.Memory))
+			workerMetrics, err := imports.LoadMetrics(workerContext(name, worker.Name))
+			if err != nil {
+				config.Log().Error().Err(err).Msgf("Worker '%s' collect metrics", worker.Name)
+			}
+			if workerMetrics == nil {
+				continue
+			}
+			set.Counter("daemons_worker_runs_total", "Number of worker runs.", labels, float64(workerMetrics.Runs))
+			set.Counter("daemons_worker_items_processed_total", "Number of processed items.", labels, float64(workerMetrics.Items))
+			set.Counter("daemons_worker_error_items_total", "Number of items processed with errors.", labels, float64(workerMetrics.ErrorItems))
+			set.Counter("daemons_worker_errors_total", "Number of errors returned by the worker hooks.", labels, float64(workerMetrics.Errors))
+			set.Counter("daemons_worker_memory_limit_breaches_total", "Number of runs and batches skipped over the memory limit.", labels, float64(workerMetrics.MemoryBreaches))
+			set.Counter("daemons_worker_retries_total", "Number of scheduled retries of failed items.", labels, float64(workerMetrics.Retries))
+			set.Counter("daemons_worker_dead_letters_total", "Number of items which have exhausted their retries.", labels, float64(workerMetrics.DeadLetters))
+			set.Gauge("daemons_worker_retry_pending", "Number of failed items waiting for retry.", labels, float64(workerMetrics.RetryPending))
+			if workerMetrics.Duration != nil {
+				set.Histogram("daemons_worker_run_duration_seconds", "Duration of the worker runs.", labels, workerMetrics.Duration)
+			}
+			if workerMetrics.BatchDuration != nil {
+				set.Histogram("daemons_worker_batch_duration_seconds", "Duration of processing of the worker batches.", labels, workerMetrics.BatchDuration)
+			}
+			set.Gauge("daemons_worker_memory_bytes", "Heap memory allocated by the worker after the last run.", labels, float64(workerMetrics.Memory))
+			set.Gauge("daemons_worker_tick_lag_seconds", "Delay of the last run start after its scheduled time.", labels, workerMetrics.TickLag.Seconds())
+		}
+	}
+}
+
+func up(state string) float64 {
+	if state == StateRunning {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,170 @@
+// Package metrics renders metrics in the Prometheus text exposition format.
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Metric types of the exposition format.
+const (
+	TypeCounter   = "counter"
+	TypeGauge     = "gauge"
+	TypeHistogram = "histogram"
+)
+
+// DefaultBuckets are upper bounds in seconds used for duration histograms.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 300}
+
+// Labels of a sample.
+type Labels map[string]string
+
+// A Histogram counts observed values in buckets with given upper bounds.
+// Counts are not cumulative, the last count is for values above all bounds.
+type Histogram struct {
+	Buckets []float64 `json:"buckets"`
+	Counts  []uint64  `json:"counts"`
+	Sum     float64   `json:"sum"`
+	Count   uint64    `json:"count"`
+}
+
+// NewHistogram returns a histogram with given bucket upper bounds, default
+// buckets are used if none are given.
+func NewHistogram(buckets ...float64) *Histogram {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	return &Histogram{Buckets: buckets, Counts: make([]uint64, len(buckets)+1)}
+}
+
+// Observe adds the value to the histogram.
+func (h *Histogram) Observe(value float64) {
+	if len(h.Counts) != len(h.Buckets)+1 {
+		h.Counts = make([]uint64, len(h.Buckets)+1)
+	}
+	h.Counts[sort.SearchFloat64s(h.Buckets, value)]++
+	h.Sum += value
+	h.Count++
+}
+
+type sample struct {
+	labels    Labels
+	value     float64
+	histogram *Histogram
+}
+
+type family struct {
+	name    string
+	help    string
+	kind    string
+	samples []sample
+}
+
+// A Set collects samples grouped by metric families.
+type Set struct {
+	families map[string]*family
+}
+
+// NewSet returns an empty set.
+func NewSet() *Set {
+	return &Set{families: make(map[string]*family)}
+}
+
+// Counter adds a sample of the counter.
+func (s *Set) Counter(name, help string, labels Labels, value float64) {
+	s.add(name, help, TypeCounter, sample{labels: labels, value: value})
+}
+
+// Gauge adds a sample of the gauge.
+func (s *Set) Gauge(name, help string, labels Labels, value float64) {
+	s.add(name, help, TypeGauge, sample{labels: labels, value: value})
+}
+
+// Histogram adds a sample of the histogram.
+func (s *Set) Histogram(name, help string, labels Labels, histogram *Histogram) {
+	s.add(name, help, TypeHistogram, sample{labels: labels, histogram: histogram})
+}
+
+func (s *Set) add(name, help, kind string, value sample) {
+	f, ok := s.families[name]
+	if !ok {
+		f = &family{name: name, help: help, kind: kind}
+		s.families[name] = f
+	}
+	f.samples = append(f.samples, value)
+}
+
+// WriteTo writes the set in the text exposition format, families are
+// sorted by name.
+func (s *Set) WriteTo(w io.Writer) (n int64, err error) {
+	var names []string
+	for name := range s.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	out := &bytes.Buffer{}
+	for _, name := range names {
+		f := s.families[name]
+		_, _ = fmt.Fprintf(out, "# HELP %s %s\n# TYPE %s %s\n", f.name, escape(f.help, false), f.name, f.kind)
+		for _, value := range f.samples {
+			if value.histogram == nil {
+				writeSample(out, f.name, value.labels, "", "", value.value)
+				continue
+			}
+			var cumulative uint64
+			for i, bound := range value.histogram.Buckets {
+				cumulative += value.histogram.Counts[i]
+				writeSample(out, f.name+"_bucket", value.labels, "le", formatFloat(bound), float64(cumulative))
+			}
+			writeSample(out, f.name+"_bucket", value.labels, "le", "+Inf", float64(value.histogram.Count))
+			writeSample(out, f.name+"_sum", value.labels, "", "", value.histogram.Sum)
+			writeSample(out, f.name+"_count", value.labels, "", "", float64(value.histogram.Count))
+		}
+	}
+	return out.WriteTo(w)
+}
+
+func writeSample(w io.Writer, name string, labels Labels, extraName, extraValue string, value float64) {
+	var keys []string
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var pairs []string
+	for _, key := range keys {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, key, escape(labels[key], true)))
+	}
+	if extraName != "" {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, extraName, extraValue))
+	}
+	if len(pairs) > 0 {
+		name += "{" + strings.Join(pairs, ",") + "}"
+	}
+	_, _ = fmt.Fprintf(w, "%s %s\n", name, formatFloat(value))
+}
+
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func escape(value string, quote bool) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, "\n", `\n`)
+	if quote {
+		value = strings.ReplaceAll(value, `"`, `\"`)
+	}
+	return value
+}
@@ -0,0 +1,58 @@
+package metrics
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestHistogramObserve(t *testing.T) {
+	h := NewHistogram(1, 0.5)
+	for _, value := range []float64{0.1, 0.5, 0.7, 2} {
+		h.Observe(value)
+	}
+	if want := []float64{0.5, 1}; !reflect.DeepEqual(h.Buckets, want) {
+		t.Errorf("Buckets = %v, want %v", h.Buckets, want)
+	}
+	// A value equal to the bound is counted in its bucket.
+	if want := []uint64{2, 1, 1}; !reflect.DeepEqual(h.Counts, want) {
+		t.Errorf("Counts = %v, want %v", h.Counts, want)
+	}
+	if h.Count != 4 || h.Sum != 3.3 {
+		t.Errorf("Count = %d, Sum = %g, want 4, 3.3", h.Count, h.Sum)
+	}
+}
+
+func TestSetWriteTo(t *testing.T) {
+	set := NewSet()
+	set.Gauge("daemons_up", "Whether the daemon is running.", Labels{"daemon": "import"}, 1)
+	set.Gauge("daemons_up", "Whether the daemon is running.", Labels{"daemon": "export"}, 0)
+	set.Counter("daemons_errors_total", "Errors\nof \\ workers.", Labels{"worker": `a "b"`, "daemon": "import"}, 2.5)
+	histogram := NewHistogram(0.1, 1)
+	histogram.Observe(0.05)
+	histogram.Observe(0.5)
+	histogram.Observe(5)
+	set.Histogram("daemons_duration_seconds", "Duration.", nil, histogram)
+	var out bytes.Buffer
+	if _, err := set.WriteTo(&out); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP daemons_duration_seconds Duration.
+# TYPE daemons_duration_seconds histogram
+daemons_duration_seconds_bucket{le="0.1"} 1
+daemons_duration_seconds_bucket{le="1"} 2
+daemons_duration_seconds_bucket{le="+Inf"} 3
+daemons_duration_seconds_sum 5.55
+daemons_duration_seconds_count 3
+# HELP daemons_errors_total Errors\nof \\ workers.
+# TYPE daemons_errors_total counter
+daemons_errors_total{daemon="import",worker="a \"b\""} 2.5
+# HELP daemons_up Whether the daemon is running.
+# TYPE daemons_up gauge
+daemons_up{daemon="import"} 1
+daemons_up{daemon="export"} 0
+`
+	if out.String() != want {
+		t.Errorf("WriteTo() =\n%s\nwant\n%s", out.String(), want)
+	}
+}
@@ -0,0 +1,36 @@
+package daemons
+
+import (
+	"github.com/phantom-d/go-daemons/metrics"
+
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetricsHandler(t *testing.T) {
+	dd := &DaemonData{Name: "watcher", collects: make(chan chan *metrics.Set), done: make(chan struct{})}
+	go func() {
+		reply := <-dd.collects
+		set := metrics.NewSet()
+		set.Gauge("daemons_up", "Whether the daemon is running.", metrics.Labels{"daemon": "import"}, 1)
+		reply <- set
+	}()
+	recorder := httptest.NewRecorder()
+	dd.metricsHandler(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if recorder.Code != http.StatusOK || !strings.HasPrefix(recorder.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Errorf("metricsHandler() = %d %q", recorder.Code, recorder.Header().Get("Content-Type"))
+	}
+	if body := recorder.Body.String(); !strings.Contains(body, `daemons_up{daemon="import"} 1`) {
+		t.Errorf("metricsHandler() body =\n%s", body)
+	}
+
+	// The stopping daemon does not collect metrics.
+	close(dd.done)
+	recorder = httptest.NewRecorder()
+	dd.metricsHandler(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("metricsHandler() of the stopping daemon = %d, want %d", recorder.Code, http.StatusServiceUnavailable)
+	}
+}
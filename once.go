@@ -0,0 +1,53 @@
+package daemons
+
+import (
+	"github.com/phantom-d/go-daemons/config"
+	"github.com/phantom-d/go-daemons/metrics"
+
+	"os"
+	"time"
+)
+
+// once runs the daemon once with --once: starts its children, which get the
+// flag too, and waits for their exit. Returns ExitError with the worst exit
+// code of the children, see config.WorseExit. On a signal the children are
+// terminated and ExitFailure is returned.
+func (dd *DaemonData) once(d DaemonInterface, stopped <-chan os.Signal, keepalive <-chan time.Time) (err error) {
+	if err = d.Run(); err != nil {
+		return
+	}
+	controller, _ := d.(Controller)
+	collector, _ := d.(Collector)
+	code := config.ExitSuccess
+	for len(dd.children) > 0 {
+		select {
+		case <-dd.ctx.Done():
+			if dd.health != nil {
+				dd.health.Stopping()
+			}
+			d.Terminate(config.StopSignal(stopped))
+			return config.NewExitError(config.ExitFailure)
+		case call := <-dd.controls:
+			call.reply <- control(controller, call.request)
+		case reply := <-dd.collects:
+			set := metrics.NewSet()
+			collector.Collect(set)
+			reply <- set
+		case <-keepalive:
+			dd.health.Tick()
+		case event := <-dd.exits:
+			exited(event)
+			delete(dd.children, event.Name)
+			exitCode := event.Code
+			if event.Err != nil {
+				exitCode = config.ExitFailure
+			}
+			code = config.WorseExit(code, exitCode)
+		}
+	}
+	if err = dd.Context.Release(); err != nil {
+		config.Log().Error().Err(err).Msgf("Daemon '%s' terminate", dd.Name)
+	}
+	config.Log().Info().Int("code", code).Msgf("daemon '%s' is done", dd.Name)
+	return config.NewExitError(code)
+}
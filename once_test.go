@@ -0,0 +1,83 @@
+package daemons
+
+import (
+	"github.com/phantom-d/go-daemons/config"
+
+	"context"
+	"os"
+	"os/exec"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// testOnceDaemon starts a child running each script and kills the children
+// on Terminate.
+type testOnceDaemon struct {
+	*DaemonData
+	shell   string
+	scripts []string
+}
+
+func (d *testOnceDaemon) SetData(data *DaemonData) {
+	d.DaemonData = data
+}
+
+func (d *testOnceDaemon) Run() error {
+	for i, script := range d.scripts {
+		ctx := &config.Context{Name: "w" + strconv.Itoa(i), Type: `worker`, Args: []string{d.shell, "-c", script}, Exits: d.exits}
+		if _, err := ctx.Run(); err != nil {
+			return err
+		}
+		d.spawned(ctx.Name, ctx)
+	}
+	return nil
+}
+
+func (d *testOnceDaemon) Terminate(os.Signal) {
+	for _, ctx := range d.children {
+		_ = ctx.Cmd().Process.Kill()
+	}
+}
+
+func TestOnce(t *testing.T) {
+	shell, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip(err)
+	}
+	tests := []struct {
+		name    string
+		scripts []string
+		stop    bool
+		want    int
+	}{
+		{name: "success", scripts: []string{"exit 0", "exit 0"}, want: config.ExitSuccess},
+		{name: "partial", scripts: []string{"exit 0", "exit 2"}, want: config.ExitPartial},
+		{name: "failure", scripts: []string{"exit 2", "exit 1"}, want: config.ExitFailure},
+		{name: "killed", scripts: []string{"kill -KILL $$"}, want: config.ExitFailure},
+		{name: "stopped", scripts: []string{"sleep 10"}, stop: true, want: config.ExitFailure},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cancel context.CancelFunc
+			dd := &DaemonData{Name: "import", Context: &config.Context{}, exits: make(chan config.ExitEvent, len(tt.scripts))}
+			dd.ctx, cancel = context.WithCancel(context.Background())
+			defer cancel()
+			if tt.stop {
+				cancel()
+			}
+			done := make(chan error, 1)
+			go func() {
+				done <- dd.once(&testOnceDaemon{DaemonData: dd, shell: shell, scripts: tt.scripts}, make(chan os.Signal), nil)
+			}()
+			select {
+			case err := <-done:
+				if got := config.ExitCode(err); got != tt.want {
+					t.Errorf("once() error = %v, want exit code %d", err, tt.want)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("once() does not return")
+			}
+		})
+	}
+}
@@ -0,0 +1,193 @@
+package daemons
+
+import (
+	"github.com/phantom-d/go-daemons/config"
+
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// spawned registers context of a child process started by the daemon and
+// emits Spawned.
+func (dd *DaemonData) spawned(name string, ctx *config.Context) {
+	if dd.children == nil {
+		dd.children = make(map[string]*config.Context)
+	}
+	dd.children[name] = ctx
+	var pid int
+	if cmd := ctx.Cmd(); cmd != nil && cmd.Process != nil {
+		pid = cmd.Process.Pid
+	}
+	emit(&Spawned{EventSource: newSource(name, ctx, pid)})
+}
+
+// signalChildren sends the signal to the running children started by the
+// daemon.
+func (dd *DaemonData) signalChildren(s os.Signal) {
+	for name, ctx := range dd.children {
+		if !ctx.Running() {
+			continue
+		}
+		if err := ctx.Cmd().Process.Signal(s); err != nil && err != os.ErrProcessDone {
+			config.Log().Error().Err(err).Msgf("Signal %s '%s'", ctx.Type, name)
+		}
+	}
+}
+
+// restartState returns restart state of the child with given name. The
+// state saved by the previous run of the daemon is loaded first, see resume.
+func (dd *DaemonData) restartState(name string) *RestartState {
+	if dd.restarts == nil {
+		dd.restarts = make(map[string]*RestartState)
+	}
+	rs, ok := dd.restarts[name]
+	if !ok {
+		rs = &RestartState{Name: name}
+		if !config.Cfg().Once {
+			if saved, err := LoadRestartState(name); err != nil {
+				config.Log().Error().Err(err).Msgf("Load restart state '%s'", name)
+			} else if saved != nil {
+				rs = saved
+				rs.resume()
+			}
+		}
+		dd.restarts[name] = rs
+	}
+	return rs
+}
+
+// alive reports whether the child process with given name is running.
+// Children started by the daemon are checked by their wait status, others
+// by the pid file. Returns the exit status of a reaped child, nil if the
+// exit status is unknown.
+func (dd *DaemonData) alive(name string, ctx *config.Context) (running bool, exit *config.ExitEvent) {
+	if child, ok := dd.children[name]; ok {
+		if exit = child.Exit(); exit == nil {
+			return true, nil
+		}
+		delete(dd.children, name)
+		return false, exit
+	}
+	running, _ = ctx.GetStatus()
+	return
+}
+
+// exited logs the exit of the child process and emits Exited.
+func exited(event config.ExitEvent) {
+	log := config.Log().Info()
+	if event.Failed() {
+		log = config.Log().Warn()
+	}
+	log.Str("name", event.Name).
+		Str("type", event.Type).
+		Int("pid", event.Pid).
+		Int("code", event.Code).
+		Str("signal", event.Signal).
+		Dur("uptime", event.Exited.Sub(event.Started)).
+		AnErr("error", event.Err).
+		Msgf("%s '%s' exited", event.Type, event.Name)
+	exit := &Exited{
+		EventSource: EventSource{Name: event.Name, Type: event.Type, Pid: event.Pid, Time: event.Exited},
+		Code:        event.Code,
+		Signal:      event.Signal,
+		Uptime:      event.Exited.Sub(event.Started),
+	}
+	if event.Err != nil {
+		exit.Error = event.Err.Error()
+	}
+	emit(exit)
+}
+
+// A childProcess is a running child process of the daemon.
+type childProcess struct {
+	name    string
+	process *os.Process
+	done    <-chan struct{}
+}
+
+// child returns the running child process with given name. Children not
+// started by the daemon are searched by the pid file.
+func (dd *DaemonData) child(name string, ctx *config.Context) (child childProcess, ok bool) {
+	if started, exists := dd.children[name]; exists && started.Running() {
+		return childProcess{name: name, process: started.Cmd().Process, done: started.Done()}, true
+	}
+	process, err := ctx.Search()
+	if err != nil {
+		config.Log().Error().Err(err).Msgf("Search %s '%s'", ctx.Type, name)
+		return
+	}
+	if process != nil {
+		child, ok = childProcess{name: name, process: process}, true
+	}
+	return
+}
+
+func (cp childProcess) exited() bool {
+	if cp.done != nil {
+		select {
+		case <-cp.done:
+			return true
+		default:
+			return false
+		}
+	}
+	return cp.process.Signal(syscall.Signal(0)) != nil
+}
+
+// terminate sends the signal to the children and waits for their exit.
+// Children still running after the timeout are killed.
+func terminate(children []childProcess, s os.Signal, timeout time.Duration) {
+	for _, child := range children {
+		config.Log().Debug().Msgf("Terminate '%s' process: %d", child.name, child.process.Pid)
+		if err := child.process.Signal(s); err != nil && err != os.ErrProcessDone {
+			config.Log().Error().Err(err).Msgf("Terminate '%s'", child.name)
+		}
+	}
+	deadline := time.Now().Add(timeout)
+	for len(children) > 0 {
+		var running []childProcess
+		for _, child := range children {
+			if !child.exited() {
+				running = append(running, child)
+			}
+		}
+		children = running
+		if len(children) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			for _, child := range children {
+				config.Log().Warn().Msgf("Kill '%s' process %d after %s", child.name, child.process.Pid, timeout)
+				if err := child.process.Kill(); err != nil && err != os.ErrProcessDone {
+					config.Log().Error().Err(err).Msgf("Kill '%s'", child.name)
+				}
+			}
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// daemonContext returns context of the daemon sufficient to find, signal
+// and hold its process.
+func daemonContext(name string) *config.Context {
+	return &config.Context{
+		Name:        name,
+		Type:        `daemon`,
+		PidFileName: filepath.Join(config.Cfg().PidDir, fmt.Sprintf("%s.pid", name)),
+	}
+}
+
+// workerContext returns context of the worker sufficient to find, signal
+// and hold its process.
+func workerContext(parent, name string) *config.Context {
+	return &config.Context{
+		Name:        name,
+		Type:        `worker`,
+		Parent:      parent,
+		PidFileName: filepath.Join(config.Cfg().PidDir, fmt.Sprintf("%s_%s.pid", parent, name)),
+	}
+}
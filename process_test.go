@@ -0,0 +1,122 @@
+package daemons
+
+import (
+	"github.com/phantom-d/go-daemons/config"
+
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// startChild starts the shell script as a child of the daemon.
+func startChild(t *testing.T, dd *DaemonData, name, script string) *config.Context {
+	shell, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip(err)
+	}
+	ctx := &config.Context{Name: name, Type: `worker`, Args: []string{shell, "-c", script}}
+	if _, err = ctx.Run(); err != nil {
+		t.Fatal(err)
+	}
+	dd.spawned(name, ctx)
+	return ctx
+}
+
+func TestAliveChild(t *testing.T) {
+	dd := &DaemonData{}
+	ctx := startChild(t, dd, "w", "sleep 10")
+	if running, exit := dd.alive("w", ctx); !running || exit != nil {
+		t.Fatalf("alive() = %v, %+v, want running", running, exit)
+	}
+	_ = ctx.Cmd().Process.Kill()
+	<-ctx.Done()
+	running, exit := dd.alive("w", ctx)
+	if running || exit == nil || exit.Signal != "killed" {
+		t.Errorf("alive() = %v, %+v, want the exit by signal", running, exit)
+	}
+	if _, ok := dd.children["w"]; ok {
+		t.Error("the exited child is still registered")
+	}
+}
+
+func TestAlivePidFile(t *testing.T) {
+	dir := t.TempDir()
+	dd := &DaemonData{}
+	tests := []struct {
+		name    string
+		pid     int
+		running bool
+	}{
+		{name: "running", pid: os.Getpid(), running: true},
+		{name: "no pid file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := &config.Context{Name: tt.name, Type: `worker`, PidFileName: filepath.Join(dir, tt.name+".pid")}
+			if tt.pid != 0 {
+				if err := os.WriteFile(ctx.PidFileName, []byte(strconv.Itoa(tt.pid)), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// A child not started by the daemon has no known exit status.
+			if running, exit := dd.alive(tt.name, ctx); running != tt.running || exit != nil {
+				t.Errorf("alive() = %v, %+v, want %v without exit", running, exit, tt.running)
+			}
+		})
+	}
+}
+
+func TestSignalChildren(t *testing.T) {
+	dd := &DaemonData{}
+	ctx := startChild(t, dd, "w", "trap 'exit 7' USR1; while :; do sleep 0.1; done")
+	// The shell sets the trap after it is started.
+	time.Sleep(200 * time.Millisecond)
+	dd.signalChildren(syscall.SIGUSR1)
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("the child is not signaled")
+	}
+	if exit := ctx.Exit(); exit.Code != 7 {
+		t.Errorf("exit code = %d, want 7 of the trap", exit.Code)
+	}
+}
+
+func TestTerminate(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		signal string
+	}{
+		{name: "graceful", script: "trap 'exit 0' TERM; while :; do sleep 0.1; done"},
+		{name: "killed after timeout", script: "trap '' TERM; while :; do sleep 0.1; done", signal: "killed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dd := &DaemonData{}
+			ctx := startChild(t, dd, "w", tt.script)
+			time.Sleep(200 * time.Millisecond)
+			child, ok := dd.child("w", ctx)
+			if !ok {
+				t.Fatal("child() found no running child")
+			}
+			started := time.Now()
+			terminate([]childProcess{child}, syscall.SIGTERM, time.Second)
+			if elapsed := time.Since(started); elapsed > 3*time.Second {
+				t.Errorf("terminate() took %s", elapsed)
+			}
+			select {
+			case <-ctx.Done():
+			case <-time.After(5 * time.Second):
+				t.Fatal("the child is running after terminate()")
+			}
+			if exit := ctx.Exit(); exit.Signal != tt.signal {
+				t.Errorf("exit signal = %q, want %q", exit.Signal, tt.signal)
+			}
+		})
+	}
+}
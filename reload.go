@@ -0,0 +1,254 @@
+package daemons
+
+import (
+	"github.com/phantom-d/go-daemons/config"
+	"github.com/phantom-d/go-daemons/imports"
+
+	"fmt"
+	"os"
+	"reflect"
+	"syscall"
+)
+
+// Reloader is implemented by daemons which apply a reloaded configuration
+// to their children. Reload is called with the previous configuration after
+// the daemon settings are updated from the new one.
+type Reloader interface {
+	Reload(previous *config.Config) error
+}
+
+// reload re-reads configuration files on SIGHUP and applies them to the
+// daemon. On failure the daemon keeps running with the previous configuration.
+func reload(d DaemonInterface) {
+	dd := d.Data()
+	if len(config.Cfg().ConfigFiles) == 0 {
+		config.Log().Warn().Msgf("Reload daemon '%s': no configuration files", dd.Name)
+		return
+	}
+	previous := *config.Cfg()
+	if err := config.Configure(); err != nil {
+		config.Log().Error().Err(err).Msgf("Reload daemon '%s'", dd.Name)
+		return
+	}
+	if err := config.OpenLog(dd.Name, ``); err != nil {
+		config.Log().Error().Err(err).Msgf("Reload daemon '%s' log file", dd.Name)
+	}
+	var changes []string
+	if fresh := New(dd.Name); fresh != nil {
+		var restart []string
+		if changes, restart = dd.update(fresh.Data()); len(changes) > 0 {
+			config.Log().Info().Strs("changes", changes).Msgf("Reload daemon '%s'", dd.Name)
+		}
+		if len(restart) > 0 {
+			config.Log().Warn().Strs("changes", restart).Msgf("Reload daemon '%s': restart required", dd.Name)
+		}
+	}
+	if reloader, ok := d.(Reloader); ok {
+		if err := reloader.Reload(&previous); err != nil {
+			config.Log().Error().Err(err).Msgf("Reload daemon '%s'", dd.Name)
+		}
+	}
+	emit(&ConfigReloaded{EventSource: newSource(dd.Name, dd.Context, os.Getpid()), Changes: changes})
+}
+
+// update applies settings of the freshly configured daemon. Changes of
+// config.RestartFields are not applied, they are returned as restart.
+func (dd *DaemonData) update(fresh *DaemonData) (changes, restart []string) {
+	for _, field := range []string{"MemoryLimit", "MemoryAction", "Workers", "Params", "Sleep", "Schedule", "Timezone", "Restart", "ShutdownTimeout"} {
+		oldValue := reflect.ValueOf(dd).Elem().FieldByName(field)
+		newValue := reflect.ValueOf(fresh).Elem().FieldByName(field)
+		if !reflect.DeepEqual(oldValue.Interface(), newValue.Interface()) {
+			changes = append(changes, fmt.Sprintf("%s: %v -> %v", field, oldValue.Interface(), newValue.Interface()))
+			oldValue.Set(newValue)
+		}
+	}
+	restart = config.RestartChanges(dd, fresh)
+	return
+}
+
+// A reloadDiff lists children affected by a configuration reload.
+type reloadDiff struct {
+	added   []string
+	removed []string
+	changed []string
+}
+
+func (diff reloadDiff) log(name string) {
+	if len(diff.added)+len(diff.removed)+len(diff.changed) == 0 {
+		return
+	}
+	config.Log().Info().
+		Strs("added", diff.added).
+		Strs("removed", diff.removed).
+		Strs("changed", diff.changed).
+		Msgf("Reload daemon '%s' children", name)
+}
+
+// Reload stops daemons removed or disabled in the new configuration and
+// sends SIGHUP to running daemons with changed configuration. Daemons with
+// changed config.RestartFields are restarted instead. Added daemons are
+// started by the next Run.
+func (watcher *Watcher) Reload(previous *config.Config) (err error) {
+	current := config.Cfg()
+	oldWorkers := previous.Daemons[watcher.Name].Workers
+	var diff reloadDiff
+	for _, name := range workerNames(oldWorkers, watcher.Workers) {
+		oldDaemon, newDaemon := previous.Daemons[name], current.Daemons[name]
+		wasEnabled := inWorkers(oldWorkers, name) && oldDaemon.Enabled
+		isEnabled := inWorkers(watcher.Workers, name) && newDaemon.Enabled
+		ctx := daemonContext(name)
+		switch {
+		case !wasEnabled && isEnabled:
+			diff.added = append(diff.added, name)
+			// Stopped by the previous reload, so the state is dropped.
+			rs := watcher.restartState(name)
+			rs.State, rs.History = ``, nil
+			if err := rs.Save(); err != nil {
+				config.Log().Error().Err(err).Msgf("Save restart state '%s'", name)
+			}
+		case wasEnabled && !isEnabled:
+			diff.removed = append(diff.removed, name)
+			rs := watcher.restartState(name)
+			rs.State = StateStopped
+			if err := rs.Save(); err != nil {
+				config.Log().Error().Err(err).Msgf("Save restart state '%s'", name)
+			}
+			watcher.stop(name, ctx)
+		case isEnabled && !reflect.DeepEqual(oldDaemon, newDaemon):
+			diff.changed = append(diff.changed, name)
+			config.Log().Info().Strs("changes", config.Diff(oldDaemon, newDaemon)).Msgf("Daemon '%s' configuration changed", name)
+			if len(config.RestartChanges(oldDaemon, newDaemon)) > 0 {
+				watcher.restart(name, ctx)
+			} else if child, ok := watcher.child(name, ctx); ok {
+				if err := child.process.Signal(syscall.SIGHUP); err != nil {
+					config.Log().Error().Err(err).Msgf("Reload daemon '%s'", name)
+				}
+			}
+		}
+	}
+	diff.log(watcher.Name)
+	return
+}
+
+// Reload stops workers removed or disabled in the new configuration and
+// replicas above the new replica count. Running workers with changed
+// configuration receive SIGHUP if they implement imports.Reloader and
+// config.RestartFields are not changed, others are restarted. Added workers
+// and replicas are started by the next Run.
+func (imp *Import) Reload(previous *config.Config) (err error) {
+	oldWorkers := previous.Daemons[imp.Name].Workers
+	oldParams := previous.Daemons[imp.Name].Params
+	var diff reloadDiff
+	for _, name := range workerNames(oldWorkers, imp.Workers) {
+		oldWorker, wasEnabled := findWorker(oldWorkers, name)
+		newWorker, isEnabled := findWorker(imp.Workers, name)
+		oldNames, newNames := replicaNames(oldWorker, wasEnabled), replicaNames(newWorker, isEnabled)
+		oldWorker.Replicas, newWorker.Replicas = 0, 0
+		changed := !reflect.DeepEqual(oldWorker, newWorker) || !reflect.DeepEqual(oldParams, imp.Params)
+		if wasEnabled && isEnabled && changed {
+			config.Log().Info().Strs("changes", config.Diff(oldWorker, newWorker)).Msgf("Worker '%s' configuration changed", name)
+		}
+		_, isReloader := imports.Unwrap(imports.Factory.CreateContextInstance(name)).(imports.Reloader)
+		isReloader = isReloader && len(config.RestartChanges(oldWorker, newWorker)) == 0
+		for _, replicaName := range oldNames {
+			ctx := workerContext(imp.Name, replicaName)
+			switch {
+			case !inNames(newNames, replicaName):
+				diff.removed = append(diff.removed, replicaName)
+				imp.stop(replicaName, ctx)
+			case !changed:
+			case !isReloader:
+				diff.changed = append(diff.changed, replicaName)
+				imp.stop(replicaName, ctx)
+			default:
+				diff.changed = append(diff.changed, replicaName)
+				if child, ok := imp.child(replicaName, ctx); ok {
+					if err := child.process.Signal(syscall.SIGHUP); err != nil {
+						config.Log().Error().Err(err).Msgf("Reload worker '%s'", replicaName)
+					}
+				}
+			}
+		}
+		for _, replicaName := range newNames {
+			if !inNames(oldNames, replicaName) {
+				diff.added = append(diff.added, replicaName)
+			}
+		}
+	}
+	diff.log(imp.Name)
+	return
+}
+
+// stop terminates the child gracefully in background.
+func (dd *DaemonData) stop(name string, ctx *config.Context) {
+	if child, ok := dd.child(name, ctx); ok {
+		go terminate([]childProcess{child}, syscall.SIGTERM, dd.ShutdownTimeout)
+	}
+}
+
+// restart stops the running daemon, it is started again by the next Run
+// regardless of its restart policy.
+func (watcher *Watcher) restart(name string, ctx *config.Context) {
+	if _, ok := watcher.child(name, ctx); !ok {
+		return
+	}
+	rs := watcher.restartState(name)
+	rs.State = ``
+	if err := rs.Save(); err != nil {
+		config.Log().Error().Err(err).Msgf("Save restart state '%s'", name)
+	}
+	watcher.stop(name, ctx)
+}
+
+func workerNames(lists ...[]config.Worker) (names []string) {
+	seen := make(map[string]bool)
+	for _, workers := range lists {
+		for _, worker := range workers {
+			if !seen[worker.Name] {
+				seen[worker.Name] = true
+				names = append(names, worker.Name)
+			}
+		}
+	}
+	return
+}
+
+// replicaNames returns names of the worker replicas, none if the worker is
+// not enabled.
+func replicaNames(worker config.Worker, enabled bool) (names []string) {
+	if !enabled {
+		return
+	}
+	for replica := 0; replica < imports.ReplicaCount(worker); replica++ {
+		names = append(names, imports.ReplicaName(worker, replica))
+	}
+	return
+}
+
+func inNames(names []string, name string) bool {
+	for _, item := range names {
+		if item == name {
+			return true
+		}
+	}
+	return false
+}
+
+func inWorkers(workers []config.Worker, name string) bool {
+	for _, worker := range workers {
+		if worker.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// findWorker returns enabled worker with given name.
+func findWorker(workers []config.Worker, name string) (worker config.Worker, ok bool) {
+	for _, worker = range workers {
+		if worker.Name == name {
+			return worker, worker.Enabled
+		}
+	}
+	return config.Worker{}, false
+}
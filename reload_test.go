@@ -0,0 +1,96 @@
+package daemons
+
+import (
+	"github.com/phantom-d/go-daemons/config"
+
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReplicaNames(t *testing.T) {
+	tests := []struct {
+		name      string
+		old, new  int
+		oldNames  []string
+		newNames  []string
+		unchanged []string
+	}{
+		{
+			name: "scale up", old: 1, new: 3,
+			oldNames: []string{"w"}, newNames: []string{"w", "w_1", "w_2"}, unchanged: []string{"w"},
+		},
+		{
+			name: "scale down", old: 3, new: 1,
+			oldNames: []string{"w", "w_1", "w_2"}, newNames: []string{"w"}, unchanged: []string{"w"},
+		},
+		{
+			name: "default replicas", old: 0, new: 2,
+			oldNames: []string{"w"}, newNames: []string{"w", "w_1"}, unchanged: []string{"w"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			oldNames := replicaNames(config.Worker{Name: "w", Replicas: tt.old}, true)
+			newNames := replicaNames(config.Worker{Name: "w", Replicas: tt.new}, true)
+			if !reflect.DeepEqual(oldNames, tt.oldNames) || !reflect.DeepEqual(newNames, tt.newNames) {
+				t.Fatalf("replicaNames() = %q -> %q, want %q -> %q", oldNames, newNames, tt.oldNames, tt.newNames)
+			}
+			// Replicas kept by the reload are neither stopped nor started.
+			var unchanged []string
+			for _, name := range oldNames {
+				if inNames(newNames, name) {
+					unchanged = append(unchanged, name)
+				}
+			}
+			if !reflect.DeepEqual(unchanged, tt.unchanged) {
+				t.Errorf("kept replicas = %q, want %q", unchanged, tt.unchanged)
+			}
+		})
+	}
+	if names := replicaNames(config.Worker{Name: "w", Replicas: 2}, false); names != nil {
+		t.Errorf("replicaNames() of disabled worker = %q, want none", names)
+	}
+}
+
+func TestDaemonDataUpdate(t *testing.T) {
+	tests := []struct {
+		name    string
+		fresh   DaemonData
+		changes int
+		restart []string
+	}{
+		{name: "unchanged"},
+		{name: "applied", fresh: DaemonData{Sleep: time.Second, MemoryLimit: 1}, changes: 2},
+		{
+			name:    "restart required",
+			fresh:   DaemonData{Sleep: time.Second, MemoryCgroup: true, Health: config.HealthCheck{Listen: ":8080"}},
+			changes: 1,
+			restart: []string{"MemoryCgroup", "Health"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dd := &DaemonData{}
+			changes, restart := dd.update(&tt.fresh)
+			if len(changes) != tt.changes {
+				t.Errorf("update() changes = %q, want %d", changes, tt.changes)
+			}
+			var fields []string
+			for _, change := range restart {
+				field, _, _ := strings.Cut(change, ":")
+				fields = append(fields, field)
+			}
+			if !reflect.DeepEqual(fields, tt.restart) {
+				t.Errorf("update() restart = %q, want changes of %q", restart, tt.restart)
+			}
+			if dd.MemoryCgroup || dd.Health.Listen != `` {
+				t.Error("update() applied the settings requiring restart")
+			}
+			if dd.Sleep != tt.fresh.Sleep {
+				t.Errorf("Sleep = %s, want %s", dd.Sleep, tt.fresh.Sleep)
+			}
+		})
+	}
+}
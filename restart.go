@@ -0,0 +1,190 @@
+package daemons
+
+import (
+	"github.com/phantom-d/go-daemons/config"
+
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// States of a daemon supervised by the watcher.
+const (
+	StateRunning = "running"
+	StateBackoff = "backoff"
+	StateStopped = "stopped"
+	StateGaveUp  = "gave-up"
+)
+
+// RestartState tracks restarts of a daemon supervised by the watcher.
+type RestartState struct {
+	Name      string      `json:"name"`
+	Policy    string      `json:"policy"`
+	State     string      `json:"state"`
+	Restarts  int         `json:"restarts"`
+	Started   time.Time   `json:"started"`
+	Exited    time.Time   `json:"exited"`
+	ExitCode  int         `json:"exit_code"`
+	Signal    string      `json:"signal,omitempty"`
+	Error     string      `json:"error,omitempty"`
+	NextStart time.Time   `json:"next_start"`
+	History   []time.Time `json:"history,omitempty"`
+}
+
+// Allow reports whether the daemon may be started now. It is called when
+// the daemon is found not running, exit is the exit status of the daemon.
+// A daemon with unknown exit status is treated as failed.
+func (rs *RestartState) Allow(policy config.RestartPolicy, exit *config.ExitEvent, now time.Time) bool {
+	rs.Policy = policy.Name()
+	switch rs.State {
+	case ``:
+		return true
+	case StateRunning:
+		failed := rs.exited(exit, now)
+		if rs.Policy == config.RestartNever || (rs.Policy == config.RestartOnFailure && !failed) {
+			rs.State = StateStopped
+			config.Log().Info().Msgf("Process '%s' exited, restart policy '%s'", rs.Name, rs.Policy)
+			return false
+		}
+		rs.prune(policy.Period(), now)
+		if policy.MaxRestarts > 0 && len(rs.History) >= policy.MaxRestarts {
+			rs.State = StateGaveUp
+			config.Log().Error().Msgf(
+				"Process '%s' restarted %d times in %s, give up", rs.Name, len(rs.History), policy.Period(),
+			)
+			return false
+		}
+		delay := policy.Delay(len(rs.History) + 1)
+		rs.State = StateBackoff
+		rs.NextStart = now.Add(delay)
+		config.Log().Warn().Msgf("Process '%s' exited, restart in %s", rs.Name, delay)
+		return delay <= 0
+	case StateBackoff:
+		return !now.Before(rs.NextStart)
+	}
+	return false
+}
+
+// exited records the exit status of the daemon and reports whether the
+// daemon has failed. A daemon with unknown exit status is treated as failed.
+func (rs *RestartState) exited(exit *config.ExitEvent, now time.Time) (failed bool) {
+	failed = true
+	rs.Exited, rs.ExitCode, rs.Signal, rs.Error = now, -1, ``, ``
+	if exit != nil {
+		failed = exit.Failed()
+		rs.Exited, rs.ExitCode, rs.Signal = exit.Exited, exit.Code, exit.Signal
+		if exit.Err != nil {
+			rs.Error = exit.Err.Error()
+		}
+	}
+	return
+}
+
+// resume prepares the state saved by the previous run of the supervisor. A
+// daemon stopped with the supervisor or given up on is started again, the
+// restarts and their history are kept, so a daemon left running is restarted
+// with the backoff after its failure.
+func (rs *RestartState) resume() {
+	switch rs.State {
+	case StateStopped, StateGaveUp:
+		rs.State = ``
+	}
+}
+
+// Start records a start of the daemon.
+func (rs *RestartState) Start(now time.Time) {
+	if rs.State != `` {
+		rs.Restarts += 1
+		rs.History = append(rs.History, now)
+	}
+	rs.State = StateRunning
+	rs.Started = now
+	rs.NextStart = time.Time{}
+}
+
+func (rs *RestartState) prune(window time.Duration, now time.Time) {
+	var history []time.Time
+	for _, t := range rs.History {
+		if now.Sub(t) < window {
+			history = append(history, t)
+		}
+	}
+	rs.History = history
+}
+
+func restartStateFile(name string) string {
+	return filepath.Join(config.Cfg().PidDir, fmt.Sprintf("%s.restart", name))
+}
+
+// LoadRestartState reads restart state of the daemon saved by the watcher.
+// Returns nil if the daemon has no saved state.
+func LoadRestartState(name string) (rs *RestartState, err error) {
+	var data []byte
+	if data, err = os.ReadFile(restartStateFile(name)); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			err = nil
+		}
+		return
+	}
+	rs = &RestartState{}
+	if err = json.Unmarshal(data, rs); err != nil {
+		rs = nil
+	}
+	return
+}
+
+// Save writes restart state of the daemon to the pid directory.
+func (rs *RestartState) Save() (err error) {
+	var data []byte
+	if data, err = json.Marshal(rs); err != nil {
+		return
+	}
+	fileName := restartStateFile(rs.Name)
+	tmpName := fileName + ".tmp"
+	if err = os.WriteFile(tmpName, data, config.FilePerm); err != nil {
+		return
+	}
+	return os.Rename(tmpName, fileName)
+}
+
+// allowStart applies the restart policy to the child found not running and
+// saves its restart state. Reports whether the child may be started now.
+func (dd *DaemonData) allowStart(name string, ctx *config.Context, policy config.RestartPolicy, exit *config.ExitEvent) (allow bool) {
+	rs := dd.restartState(name)
+	state, now := rs.State, time.Now()
+	allow = rs.Allow(policy, exit, now)
+	switch {
+	case state == StateRunning && rs.State == StateBackoff:
+		emit(&Restarting{EventSource: newSource(ctx.Name, ctx, 0), Delay: rs.NextStart.Sub(now), Restarts: rs.Restarts + 1})
+	case state != StateGaveUp && rs.State == StateGaveUp:
+		emit(&BackoffGiveUp{EventSource: newSource(ctx.Name, ctx, 0), Restarts: len(rs.History), Window: policy.Period()})
+	}
+	if allow {
+		rs.Start(now)
+	}
+	if allow || state != rs.State {
+		if err := rs.Save(); err != nil {
+			config.Log().Error().Err(err).Msgf("Save restart state '%s'", name)
+		}
+	}
+	return
+}
+
+// stopped records the children terminated with the daemon as stopped, so
+// their next start is not taken for a restart after failure.
+func (dd *DaemonData) stopped(names []string) {
+	for _, name := range names {
+		rs := dd.restartState(name)
+		if rs.State != StateRunning {
+			continue
+		}
+		rs.State = StateStopped
+		if err := rs.Save(); err != nil {
+			config.Log().Error().Err(err).Msgf("Save restart state '%s'", name)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package daemons
+
+import (
+	"github.com/phantom-d/go-daemons/config"
+
+	"testing"
+	"time"
+)
+
+func TestAllowStartSavedState(t *testing.T) {
+	tests := []struct {
+		name  string
+		saved *RestartState
+		allow bool
+		state string
+	}{
+		{name: "no saved state", allow: true, state: StateRunning},
+		{
+			name:  "left running",
+			saved: &RestartState{State: StateRunning, Restarts: 2},
+			state: StateBackoff,
+		},
+		{
+			name:  "backoff",
+			saved: &RestartState{State: StateBackoff, Restarts: 2, NextStart: time.Now().Add(time.Hour)},
+			state: StateBackoff,
+		},
+		{
+			name:  "stopped with the supervisor",
+			saved: &RestartState{State: StateStopped, Restarts: 2},
+			allow: true,
+			state: StateRunning,
+		},
+		{
+			name:  "given up",
+			saved: &RestartState{State: StateGaveUp, Restarts: 2},
+			allow: true,
+			state: StateRunning,
+		},
+	}
+	defer func(cfg config.Config) { *config.Cfg() = cfg }(*config.Cfg())
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.Cfg().PidDir = t.TempDir()
+			if tt.saved != nil {
+				tt.saved.Name = "import_w"
+				if err := tt.saved.Save(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			dd := &DaemonData{}
+			ctx := workerContext("import", "w")
+			if allow := dd.allowStart("import_w", ctx, config.RestartPolicy{}, nil); allow != tt.allow {
+				t.Errorf("allowStart() = %v, want %v", allow, tt.allow)
+			}
+			saved, err := LoadRestartState("import_w")
+			if err != nil || saved == nil {
+				t.Fatalf("LoadRestartState() = %v, %v", saved, err)
+			}
+			if saved.State != tt.state {
+				t.Errorf("saved state = %q, want %q", saved.State, tt.state)
+			}
+			if tt.saved != nil && saved.Restarts < tt.saved.Restarts {
+				t.Errorf("saved restarts = %d, want at least %d", saved.Restarts, tt.saved.Restarts)
+			}
+		})
+	}
+}
+
+func TestStoppedChildren(t *testing.T) {
+	defer func(cfg config.Config) { *config.Cfg() = cfg }(*config.Cfg())
+	config.Cfg().PidDir = t.TempDir()
+	dd := &DaemonData{}
+	ctx := workerContext("import", "w")
+	dd.allowStart("import_w", ctx, config.RestartPolicy{Policy: config.RestartNever}, nil)
+	dd.stopped([]string{"import_w"})
+
+	// The next supervisor starts the worker stopped with the previous one
+	// even with the "never" policy.
+	next := &DaemonData{}
+	if !next.allowStart("import_w", ctx, config.RestartPolicy{Policy: config.RestartNever}, nil) {
+		t.Error("allowStart() of the stopped worker = false, want true")
+	}
+}
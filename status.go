@@ -0,0 +1,255 @@
+package daemons
+
+import (
+	"github.com/phantom-d/go-daemons/config"
+	"github.com/phantom-d/go-daemons/imports"
+
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+)
+
+// StateFailed is reported for a process which has exited abnormally and
+// is not going to be restarted.
+const StateFailed = "failed"
+
+// A ProcessStatus describes state of a daemon or a worker process.
+type ProcessStatus struct {
+	Name      string     `json:"name"`
+	State     string     `json:"state"`
+	Pid       int        `json:"pid,omitempty"`
+	Started   *time.Time `json:"started,omitempty"`
+	Uptime    string     `json:"uptime,omitempty"`
+	Restarts  int        `json:"restarts"`
+	ExitCode  *int       `json:"exit_code,omitempty"`
+	Signal    string     `json:"signal,omitempty"`
+	Memory    uint64     `json:"rss,omitempty"`
+	NextStart *time.Time `json:"next_start,omitempty"`
+	NextRun   *time.Time `json:"next_run,omitempty"`
+	LastError string     `json:"last_error,omitempty"`
+}
+
+// A WorkerStatus describes state of a worker and its last run.
+type WorkerStatus struct {
+	ProcessStatus
+	Result *imports.Summary `json:"result,omitempty"`
+}
+
+// A DaemonStatus describes state of a daemon and its workers.
+type DaemonStatus struct {
+	ProcessStatus
+	Count struct {
+		Current int `json:"current"`
+		Total   int `json:"total"`
+	} `json:"count"`
+	Workers []WorkerStatus `json:"workers,omitempty"`
+}
+
+// Status returns status of the daemon with given name. For the watcher
+// status of every daemon it supervises is returned.
+func Status(name string) (statuses map[string]DaemonStatus, err error) {
+	if name == `` {
+		name = `watcher`
+	}
+	cfg, ok := config.Cfg().Daemons[name]
+	if !ok {
+		return nil, fmt.Errorf("daemon: unknown daemon %q", name)
+	}
+	statuses = make(map[string]DaemonStatus)
+	if _, isWatcher := Factory.CreateInstance(name).(*Watcher); isWatcher {
+		for _, daemon := range cfg.Workers {
+			statuses[daemon.Name] = daemonStatus(daemon.Name)
+		}
+	} else {
+		statuses[name] = daemonStatus(name)
+	}
+	return
+}
+
+// DaemonsStatus returns status of the daemon with given name as JSON.
+func DaemonsStatus(name string) (result []byte, err error) {
+	var statuses map[string]DaemonStatus
+	if statuses, err = Status(name); err != nil {
+		return
+	}
+	result, err = json.Marshal(statuses)
+	return
+}
+
+func daemonStatus(name string) (status DaemonStatus) {
+	rs, err := LoadRestartState(name)
+	if err != nil {
+		config.Log().Error().Err(err).Msgf("Status daemon '%s'", name)
+	}
+	daemon := config.Cfg().Daemons[name]
+	status.ProcessStatus = processStatus(name, daemonContext(name), rs)
+	if status.State == StateRunning {
+		status.NextRun = nextRun(daemon.Schedule, daemon.Timezone)
+	}
+	for _, cfg := range daemon.Workers {
+		if imports.Factory.CreateInstance(cfg.Name) == nil {
+			continue
+		}
+		for replica := 0; replica < imports.ReplicaCount(cfg); replica++ {
+			worker := workerStatus(name, imports.ReplicaName(cfg, replica))
+			if worker.State == StateRunning {
+				worker.NextRun = nextRun(cfg.Schedule, cfg.Timezone)
+			}
+			if cfg.Enabled {
+				status.Count.Total += 1
+				if worker.State == StateRunning {
+					status.Count.Current += 1
+				}
+			}
+			status.Workers = append(status.Workers, worker)
+		}
+	}
+	return
+}
+
+func workerStatus(parent, name string) (status WorkerStatus) {
+	ctx := workerContext(parent, name)
+	rs, err := LoadRestartState(parent + "_" + name)
+	if err != nil {
+		config.Log().Error().Err(err).Msgf("Status worker '%s'", name)
+	}
+	status.ProcessStatus = processStatus(name, ctx, rs)
+	if status.Result, err = imports.LoadSummary(ctx); err != nil {
+		config.Log().Error().Err(err).Msgf("Status worker '%s'", name)
+	}
+	if status.Result != nil && status.Result.LastError != `` && status.State == StateRunning {
+		status.LastError = status.Result.LastError
+	}
+	return
+}
+
+// nextRun returns time of the next scheduled run, nil if there is no
+// schedule.
+func nextRun(schedule, timezone string) *time.Time {
+	if schedule == `` {
+		return nil
+	}
+	timer, err := config.NewTimer(schedule, timezone, 0)
+	if err != nil {
+		return nil
+	}
+	next := timer.Next(time.Now())
+	return &next
+}
+
+// processStatus collects state of the process from its pid file, /proc and
+// restart state saved by the supervisor.
+func processStatus(name string, ctx *config.Context, rs *RestartState) (status ProcessStatus) {
+	status.Name = name
+	status.State = StateStopped
+	process, err := ctx.Search()
+	if err != nil {
+		status.LastError = err.Error()
+	}
+	if process != nil && process.Signal(syscall.Signal(0)) == nil {
+		status.State = StateRunning
+		status.Pid = process.Pid
+		if info, err := os.Stat(ctx.PidFileName); err == nil {
+			started := info.ModTime()
+			status.Started = &started
+			status.Uptime = config.FmtDuration(time.Since(started))
+		}
+		if status.Memory, err = config.ProcessMemory(process.Pid); err != nil {
+			status.LastError = err.Error()
+		}
+	}
+	if rs == nil {
+		return
+	}
+	status.Restarts = rs.Restarts
+	if !rs.Exited.IsZero() {
+		exitCode := rs.ExitCode
+		status.ExitCode = &exitCode
+		status.Signal = rs.Signal
+	}
+	if rs.Error != `` {
+		status.LastError = rs.Error
+	}
+	if status.State == StateRunning || ctx.Held() {
+		return
+	}
+	switch rs.State {
+	case StateBackoff:
+		status.State = StateBackoff
+		nextStart := rs.NextStart
+		status.NextStart = &nextStart
+	case StateGaveUp:
+		status.State = StateFailed
+	}
+	return
+}
+
+// WriteStatus renders statuses as a table.
+func WriteStatus(w io.Writer, statuses map[string]DaemonStatus) error {
+	var names []string
+	for name := range statuses {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	table := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(table, "NAME\tSTATE\tPID\tUPTIME\tRESTARTS\tEXIT\tRSS\tLAST RUN\tNEXT RUN\tERROR")
+	for _, name := range names {
+		status := statuses[name]
+		writeStatusRow(table, name, status.ProcessStatus, nil)
+		for _, worker := range status.Workers {
+			writeStatusRow(table, name+"/"+worker.Name, worker.ProcessStatus, worker.Result)
+		}
+	}
+	return table.Flush()
+}
+
+func writeStatusRow(w io.Writer, name string, status ProcessStatus, result *imports.Summary) {
+	columns := []string{name, status.State, "-", "-", fmt.Sprint(status.Restarts), "-", "-", "-", "-", "-"}
+	if status.Pid > 0 {
+		columns[2] = fmt.Sprint(status.Pid)
+	}
+	if status.Uptime != `` {
+		columns[3] = status.Uptime
+	}
+	if status.ExitCode != nil {
+		columns[5] = fmt.Sprint(*status.ExitCode)
+		if status.Signal != `` {
+			columns[5] = status.Signal
+		}
+	}
+	if status.Memory > 0 {
+		columns[6] = formatBytes(status.Memory)
+	}
+	if result != nil {
+		columns[7] = fmt.Sprintf("%d items, %d errors, %s", result.Total, result.Errors, result.Duration.Round(time.Millisecond))
+		if result.Retrying > 0 || result.DeadLetters > 0 {
+			columns[7] += fmt.Sprintf(", %d retrying, %d dead", result.Retrying, result.DeadLetters)
+		}
+	}
+	if status.NextRun != nil {
+		columns[8] = status.NextRun.Format(time.RFC3339)
+	}
+	if status.LastError != `` {
+		columns[9] = status.LastError
+	}
+	_, _ = fmt.Fprintln(w, strings.Join(columns, "\t"))
+}
+
+func formatBytes(size uint64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%dB", size)
+	}
+	div, exp := uint64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%c", float64(size)/float64(div), "KMGTPE"[exp])
+}
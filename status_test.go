@@ -0,0 +1,126 @@
+package daemons
+
+import (
+	"github.com/phantom-d/go-daemons/config"
+	"github.com/phantom-d/go-daemons/imports"
+
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProcessStatus(t *testing.T) {
+	nextStart := time.Now().Add(time.Minute)
+	exited := time.Now().Add(-time.Minute)
+	tests := []struct {
+		name     string
+		running  bool
+		held     bool
+		rs       *RestartState
+		state    string
+		exitCode int
+		signal   string
+	}{
+		{name: "running", running: true, rs: &RestartState{State: StateRunning}, state: StateRunning},
+		{name: "stopped", state: StateStopped},
+		{
+			name:  "backoff",
+			rs:    &RestartState{State: StateBackoff, NextStart: nextStart, Exited: exited, ExitCode: 2},
+			state: StateBackoff, exitCode: 2,
+		},
+		{
+			name:  "held in backoff",
+			held:  true,
+			rs:    &RestartState{State: StateBackoff, NextStart: nextStart},
+			state: StateStopped,
+		},
+		{
+			name:  "gave up",
+			rs:    &RestartState{State: StateGaveUp, Exited: exited, ExitCode: -1, Signal: "killed"},
+			state: StateFailed, exitCode: -1, signal: "killed",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := &config.Context{Name: "w", Type: `worker`, PidFileName: filepath.Join(t.TempDir(), "import_w.pid")}
+			if tt.running {
+				if err := os.WriteFile(ctx.PidFileName, []byte(strconv.Itoa(os.Getpid())), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.held {
+				if err := ctx.Hold(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			status := processStatus("w", ctx, tt.rs)
+			if status.State != tt.state {
+				t.Errorf("State = %q, want %q", status.State, tt.state)
+			}
+			if tt.running && (status.Pid != os.Getpid() || status.Started == nil || status.Memory == 0) {
+				t.Errorf("status = %+v, want pid, start time and memory of the process", status)
+			}
+			if tt.exitCode != 0 && (status.ExitCode == nil || *status.ExitCode != tt.exitCode || status.Signal != tt.signal) {
+				t.Errorf("status = %+v, want exit code %d, signal %q", status, tt.exitCode, tt.signal)
+			}
+			if (status.NextStart != nil) != (tt.state == StateBackoff) {
+				t.Errorf("NextStart = %v in state %q", status.NextStart, status.State)
+			}
+		})
+	}
+}
+
+func TestWriteStatus(t *testing.T) {
+	exitCode := 1
+	statuses := map[string]DaemonStatus{
+		"import": {
+			ProcessStatus: ProcessStatus{Name: "import", State: StateRunning, Pid: 10, Uptime: "1m0s", Memory: 3 << 20},
+			Workers: []WorkerStatus{
+				{
+					ProcessStatus: ProcessStatus{Name: "users", State: StateBackoff, Restarts: 2, ExitCode: &exitCode, LastError: "boom"},
+					Result:        &imports.Summary{Total: 5, Errors: 1, Duration: 1500 * time.Millisecond, Retrying: 1},
+				},
+			},
+		},
+		"export": {ProcessStatus: ProcessStatus{Name: "export", State: StateStopped}},
+	}
+	var out bytes.Buffer
+	if err := WriteStatus(&out, statuses); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	want := [][]string{
+		{"NAME", "STATE", "PID", "UPTIME", "RESTARTS", "EXIT", "RSS", "LAST", "RUN", "NEXT", "RUN", "ERROR"},
+		{"export", "stopped", "-", "-", "0", "-", "-", "-", "-", "-"},
+		{"import", "running", "10", "1m0s", "0", "-", "3.0M", "-", "-", "-"},
+		{"import/users", "backoff", "-", "-", "2", "1", "-", "5", "items,", "1", "errors,", "1.5s,", "1", "retrying,", "0", "dead", "-", "boom"},
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("WriteStatus() =\n%s\nwant %d lines", out.String(), len(want))
+	}
+	for i, line := range lines {
+		if got := strings.Fields(line); strings.Join(got, " ") != strings.Join(want[i], " ") {
+			t.Errorf("line %d = %q, want %q", i, got, want[i])
+		}
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		size uint64
+		want string
+	}{
+		{size: 512, want: "512B"},
+		{size: 1536, want: "1.5K"},
+		{size: 5 << 30, want: "5.0G"},
+	}
+	for _, tt := range tests {
+		if got := formatBytes(tt.size); got != tt.want {
+			t.Errorf("formatBytes(%d) = %q, want %q", tt.size, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package daemons
+
+import (
+	"github.com/phantom-d/go-daemons/config"
+	"github.com/phantom-d/go-daemons/imports"
+
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+func init() {
+	config.RegisterValidator(validateConfig)
+}
+
+// CheckConfig validates the application configuration and writes the
+// report to w. Returns the validation error, if any.
+func CheckConfig(w io.Writer) (err error) {
+	if err = config.Cfg().Validate(); err != nil {
+		_, _ = fmt.Fprintln(w, err)
+		return
+	}
+	_, _ = fmt.Fprintln(w, "config: OK")
+	return
+}
+
+// validateConfig checks references of configured daemons and workers
+// to the registered factories.
+func validateConfig(cfg *config.Config, errs *config.ValidationError) {
+	for _, name := range cfg.DaemonNames() {
+		daemon := cfg.Daemons[name]
+		path := "Daemons." + name
+		instance := Factory.CreateInstance(name)
+		if instance == nil {
+			errs.Add(path, "daemon is not registered, known daemons: %s", strings.Join(Factory.Names(), ", "))
+			continue
+		}
+		switch instance.(type) {
+		case *Watcher:
+			for i, worker := range daemon.Workers {
+				if _, ok := cfg.Daemons[worker.Name]; !ok && worker.Name != "" {
+					errs.Add(fmt.Sprintf("%s.Workers[%d].Name", path, i), "unknown daemon %q", worker.Name)
+				}
+			}
+		case *Import:
+			for i, worker := range daemon.Workers {
+				workerPath := fmt.Sprintf("%s.Workers[%d]", path, i)
+				if imports.Factory.CreateInstance(worker.Name) == nil && worker.Name != "" {
+					errs.Add(workerPath+".Name", "worker %q is not registered, known workers: %s",
+						worker.Name, strings.Join(imports.Factory.Names(), ", "))
+				}
+				if worker.Enabled && worker.Sleep <= 0 && worker.Schedule == "" {
+					errs.Add(workerPath+".Sleep", "must be > 0 if Schedule is not set")
+				}
+				if _, err := imports.ParseQueue(worker.Queue); err != nil {
+					errs.Add(workerPath+".Queue", "%s", err)
+				}
+			}
+		}
+	}
+}
+
+// Names returns names of registered daemons in sorted order.
+func (factory *FactoryData) Names() (names []string) {
+	for name := range *factory {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return
+}
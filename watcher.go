@@ -2,8 +2,6 @@ package daemons
 
 import (
 	"github.com/phantom-d/go-daemons/config"
-	"os"
-	"syscall"
 )
 
 type Watcher struct {
@@ -17,22 +15,25 @@ func (watcher *Watcher) SetData(data *DaemonData) {
 func (watcher *Watcher) Run() (err error) {
 	for _, cfg := range watcher.Workers {
 		if daemon := New(cfg.Name); daemon != nil {
-			var dm *os.Process
-			dm, err = daemon.Data().Context.Search()
-			if err != nil {
-				config.Log().Error().Err(err).Msgf("Exec daemon '%s'", cfg.Name)
-			} else if dm != nil {
-				err = dm.Signal(syscall.Signal(0))
-				if err == os.ErrProcessDone {
-					dm = nil
-				}
+			ctx := daemon.Data().Context
+			running, exit := watcher.alive(cfg.Name, ctx)
+			rs := watcher.restartState(cfg.Name)
+			if running && !ctx.Held() {
+				watcher.checkMemory(cfg.Name, ctx, rs, daemon.Data().MemoryLimit, daemon.Data().MemoryAction)
+			}
+			if running || ctx.Held() {
+				continue
 			}
-			if dm == nil {
-				if err = Exec(daemon); err != nil {
-					config.Log().Error().Err(err).Msgf("Exec daemon '%s'", cfg.Name)
-					err = nil
-				}
+			if !watcher.allowStart(cfg.Name, ctx, daemon.Data().Restart, exit) {
+				continue
+			}
+			ctx.Exits, ctx.Stopped = watcher.exits, watcher.done
+			if err = Exec(daemon); err != nil {
+				config.Log().Error().Err(err).Msgf("Exec daemon '%s'", cfg.Name)
+				err = nil
+				continue
 			}
+			watcher.spawned(cfg.Name, ctx)
 		}
 	}
 	return